@@ -0,0 +1,153 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// accountDeletionGracePeriod is how long a deleted account can still be restored before it is purged
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+	// purgeBatchSize bounds how many accounts are read per query while purging
+	purgeBatchSize = 100
+)
+
+// scheduleAccountDeletion marks the account for purging once the grace period is over and revokes
+// every refresh token, personal access token and OAuth grant, so nothing keeps acting for it
+func (cfg *Config) scheduleAccountDeletion(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	var user database.User
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		now := time.Now()
+		revokedAt := sql.NullTime{Time: now, Valid: true}
+		var err error
+		user, err = q.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{
+			ID:          userID,
+			DeleteAfter: sql.NullTime{Time: now.Add(accountDeletionGracePeriod), Valid: true},
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.RevokeUserRefreshTokens(ctx, database.RevokeUserRefreshTokensParams{UserID: userID, RevokedAt: revokedAt}); err != nil {
+			return err
+		}
+		if err := q.RevokeUserPersonalAccessTokens(ctx, database.RevokeUserPersonalAccessTokensParams{UserID: userID, RevokedAt: revokedAt}); err != nil {
+			return err
+		}
+		return q.RevokeUserOAuthGrants(ctx, database.RevokeUserOAuthGrantsParams{UserID: userID, RevokedAt: revokedAt})
+	})
+	return user, err
+}
+
+// sendAccountDeletionNotice tells the user when their account will be purged and how to stop it
+func (cfg *Config) sendAccountDeletionNotice(ctx context.Context, user database.User) error {
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: fmt.Sprintf("Your account and everything in it will be permanently deleted after %s.\n\nIf you did not ask for this, log in and send DELETE /api/users/deletion before then to keep your account, and change your password.\n",
+			user.DeleteAfter.Time.UTC().Format(time.RFC1123)),
+	})
+}
+
+// PurgeDeletedAccounts purges accounts whose grace period is over now and then every interval,
+// until ctx is done
+func (cfg *Config) PurgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := cfg.purgeDueAccounts(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error purging deleted accounts: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDueAccounts deletes every account scheduled for deletion at or before now and returns how
+// many were deleted. An account that fails is logged and left for the next run.
+func (cfg *Config) purgeDueAccounts(ctx context.Context, now time.Time) (int, error) {
+	purged := 0
+	failed := map[uuid.UUID]bool{}
+	for {
+		users, err := cfg.DbQueries.GetUsersDueForDeletion(ctx, database.GetUsersDueForDeletionParams{
+			Now:       now,
+			BatchSize: purgeBatchSize,
+		})
+		if err != nil {
+			return purged, err
+		}
+		progress := false
+		for _, user := range users {
+			if failed[user.ID] {
+				continue
+			}
+			deleted, err := cfg.purgeAccount(ctx, user, now)
+			if err != nil {
+				log.Printf("Error purging account %s: %v", user.ID, err)
+				failed[user.ID] = true
+				continue
+			}
+			if !deleted {
+				continue
+			}
+			purged++
+			progress = true
+		}
+		if len(users) < purgeBatchSize || !progress {
+			return purged, nil
+		}
+	}
+}
+
+// purgeAccount deletes user, whose chirps, sessions, tokens and other rows go with it through
+// ON DELETE CASCADE. Like and rechirp counts on other users' chirps are lowered first since
+// they are kept on the chirps rather than counted. It reports false if the deletion was
+// cancelled in the meantime.
+func (cfg *Config) purgeAccount(ctx context.Context, user database.User, now time.Time) (bool, error) {
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		// The row lock keeps new likes and rechirps out until the account is gone, and a
+		// deletion cancelled since the account was read leaves nothing to lock
+		if _, err := q.LockUserForDeletion(ctx, database.LockUserForDeletionParams{
+			ID:          user.ID,
+			DeleteAfter: sql.NullTime{Time: now, Valid: true},
+		}); err != nil {
+			return err
+		}
+		if err := q.UncountUserLikes(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.UncountUserRechirps(ctx, user.ID); err != nil {
+			return err
+		}
+		return q.DeleteUser(ctx, user.ID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Failed logins are kept by email, an address that signs up again starts afresh
+	if cfg.AccountLimiter != nil {
+		if err := cfg.AccountLimiter.Reset(ctx, accountLockoutKey(user.Email)); err != nil {
+			log.Printf("Error clearing failed logins for %s: %v", user.Email, err)
+		}
+	}
+	return true, nil
+}
@@ -1,17 +1,30 @@
 package api
 
 import (
+	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"chirpy/internal/lockout"
+	"chirpy/internal/mail"
+	"chirpy/internal/oidc"
+	"chirpy/internal/passwordpolicy"
+	"database/sql"
 	"net/http"
 	"sync/atomic"
 )
 
 type Config struct {
-	DbQueries      *database.Queries
-	FileserverHits atomic.Int32
-	Platform       string
-	BearerToken    string
-	APIKey         string
+	DB                       *sql.DB
+	DbQueries                *database.Queries
+	FileserverHits           atomic.Int32
+	Platform                 string
+	JWTKeys                  *auth.Keyring
+	APIKey                   string
+	Mailer                   mail.Mailer
+	RequireEmailVerification bool
+	AccountLimiter           *lockout.Limiter
+	IPLimiter                *lockout.Limiter
+	OIDC                     *oidc.Provider
+	PasswordPolicy           passwordpolicy.Policy
 }
 
 func (cfg *Config) MiddlewareMetricsInc(next http.Handler) http.Handler {
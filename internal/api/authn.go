@@ -0,0 +1,244 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes a personal access token can be granted. Access tokens from a login carry every scope.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+	ScopeFollowsWrite = "follows:write"
+	// ScopeAccount guards credentials, sessions and tokens, it is never granted to a personal access token
+	ScopeAccount = "account"
+)
+
+var grantableScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeFollowsWrite}
+
+// Kinds of bearer token a Principal can come from
+const (
+	TokenTypeAccess              = "access_token"
+	TokenTypePersonalAccessToken = "personal_access_token"
+	TokenTypeOAuth               = "oauth_access_token"
+)
+
+var (
+	errMissingToken = errors.New("missing Authorization header")
+	errInvalidToken = errors.New("invalid token")
+)
+
+// scopeError is returned when a valid token is not allowed to do what the request needs
+type scopeError struct {
+	scope string
+}
+
+func (e *scopeError) Error() string {
+	return fmt.Sprintf("token is missing the %s scope", e.scope)
+}
+
+// Principal is the user a request acts for and the credential it came with
+type Principal struct {
+	UserID    uuid.UUID
+	TokenType string
+	Scopes    []string
+	// Role comes from the access token, personal access tokens and OAuth clients always act as RoleUser
+	Role string
+	// SessionID is the login session of a JWT access token
+	SessionID uuid.NullUUID
+	// TokenID is set when the request used a personal access token
+	TokenID uuid.NullUUID
+	// ClientID is set when the request came from an OAuth client acting for the user
+	ClientID uuid.NullUUID
+}
+
+// HasScope reports whether the principal may act with scope
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal RequireAuth or OptionalAuth stored in ctx
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// mustPrincipal returns the principal of a request served behind RequireAuth. Handlers that
+// call it on a route registered without the middleware are a wiring bug, so it panics.
+func mustPrincipal(req *http.Request) Principal {
+	p, ok := PrincipalFromContext(req.Context())
+	if !ok {
+		panic("api: handler requires RequireAuth middleware")
+	}
+	return p
+}
+
+// RequireAuth only calls next for requests with a valid bearer token allowed scope, the
+// principal is then available from the request context
+func (cfg *Config) RequireAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p, err := cfg.authenticate(req, scope)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		next(w, req.WithContext(withPrincipal(req.Context(), p)))
+	}
+}
+
+// OptionalAuth lets anonymous requests through. A token that is allowed scope puts its
+// principal in the context. One that isn't, or that is expired or otherwise invalid, leaves
+// the request anonymous, so a client with a stale token can still read public data.
+func (cfg *Config) OptionalAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p, err := cfg.authenticate(req, scope)
+		var scopeErr *scopeError
+		switch {
+		case err == nil:
+			req = req.WithContext(withPrincipal(req.Context(), p))
+		case errors.Is(err, errMissingToken), errors.Is(err, errInvalidToken), errors.As(err, &scopeErr):
+		default:
+			respondWithAuthError(w, err)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// authenticate resolves the bearer token of req, either a JWT access token or a personal
+// access token, and checks that it is allowed scope
+func (cfg *Config) authenticate(req *http.Request, scope string) (Principal, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil || token == "" {
+		return Principal{}, errMissingToken
+	}
+
+	var p Principal
+	if auth.IsPersonalAccessToken(token) {
+		p, err = cfg.personalAccessTokenPrincipal(req, token)
+		if err != nil {
+			return Principal{}, err
+		}
+	} else {
+		claims, err := auth.ParseJWT(token, cfg.JWTKeys)
+		if err != nil {
+			return Principal{}, errInvalidToken
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			return Principal{}, errInvalidToken
+		}
+		if claims.ClientID != "" {
+			p, err = cfg.oauthPrincipal(req, userID, claims)
+			if err != nil {
+				return Principal{}, err
+			}
+			if !p.HasScope(scope) {
+				return Principal{}, &scopeError{scope: scope}
+			}
+			return p, nil
+		}
+		p = Principal{
+			UserID:    userID,
+			TokenType: TokenTypeAccess,
+			Scopes:    append(slices.Clone(grantableScopes), ScopeAccount),
+			Role:      RoleUser,
+			SessionID: claims.Session(),
+		}
+		// Tokens issued before roles existed carry none
+		if claims.Role != "" {
+			p.Role = claims.Role
+		}
+	}
+
+	if !p.HasScope(scope) {
+		return Principal{}, &scopeError{scope: scope}
+	}
+	return p, nil
+}
+
+func (cfg *Config) personalAccessTokenPrincipal(req *http.Request, token string) (Principal, error) {
+	pat, err := cfg.DbQueries.GetPersonalAccessTokenByHash(req.Context(), auth.HashToken(token))
+	if err != nil {
+		return Principal{}, errInvalidToken
+	}
+	if pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && pat.ExpiresAt.Time.Before(time.Now())) {
+		return Principal{}, errInvalidToken
+	}
+
+	// Last use is informational, a failed update shouldn't fail the request
+	if err := cfg.DbQueries.TouchPersonalAccessToken(req.Context(), database.TouchPersonalAccessTokenParams{
+		ID:         pat.ID,
+		LastUsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}); err != nil {
+		log.Printf("Error recording use of personal access token %s: %v", pat.ID, err)
+	}
+	// The account scope is never grantable, drop it should a stored token somehow carry it
+	scopes := slices.DeleteFunc(slices.Clone(pat.Scopes), func(s string) bool { return s == ScopeAccount })
+	return Principal{
+		UserID:    pat.UserID,
+		TokenType: TokenTypePersonalAccessToken,
+		Scopes:    scopes,
+		Role:      RoleUser,
+		TokenID:   uuid.NullUUID{UUID: pat.ID, Valid: true},
+	}, nil
+}
+
+// oauthPrincipal checks that the grant an OAuth access token was issued under is still in place,
+// so revoking it cuts the client off before the token expires
+func (cfg *Config) oauthPrincipal(req *http.Request, userID uuid.UUID, claims *auth.AccessClaims) (Principal, error) {
+	clientID, err := uuid.Parse(claims.ClientID)
+	if err != nil || !claims.Session().Valid {
+		return Principal{}, errInvalidToken
+	}
+	grant, err := cfg.DbQueries.GetOAuthGrant(req.Context(), claims.Session().UUID)
+	if err != nil || grant.RevokedAt.Valid || grant.UserID != userID || grant.ClientID != clientID {
+		return Principal{}, errInvalidToken
+	}
+	scopes := slices.DeleteFunc(claims.Scopes(), func(s string) bool { return s == ScopeAccount })
+	return Principal{
+		UserID:    userID,
+		TokenType: TokenTypeOAuth,
+		Scopes:    scopes,
+		Role:      RoleUser,
+		ClientID:  uuid.NullUUID{UUID: clientID, Valid: true},
+	}, nil
+}
+
+// respondWithAuthError responds 401 for missing or bad credentials and 403 for a missing scope,
+// with the matching RFC 6750 WWW-Authenticate challenge
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	var scopeErr *scopeError
+	switch {
+	case errors.Is(err, errMissingToken):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+		respondWithError(w, http.StatusUnauthorized, "Missing Authorization header")
+	case errors.As(err, &scopeErr):
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope=%q`, scopeErr.scope))
+		if scopeErr.scope == ScopeAccount {
+			respondWithError(w, http.StatusForbidden, "Personal access tokens cannot manage the account, log in instead")
+			return
+		}
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the %s scope", scopeErr.scope))
+	default:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="invalid_token"`)
+		respondWithError(w, http.StatusUnauthorized, "User not authorized")
+	}
+}
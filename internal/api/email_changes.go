@@ -0,0 +1,51 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"fmt"
+	"time"
+)
+
+const emailChangeTokenTTL = 24 * time.Hour
+
+// requestEmailChange stores a single-use token for moving user to newEmail and mails it to the
+// new address, the old address is told about the request. Any earlier pending change is dropped.
+func (cfg *Config) requestEmailChange(ctx context.Context, user database.User, newEmail string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		if err := q.DeletePendingEmailChangeTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		_, err := q.CreateEmailChangeToken(ctx, database.CreateEmailChangeTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    user.ID,
+			NewEmail:  newEmail,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(emailChangeTokenTTL),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address by sending the token below to POST /api/users/email/verify.\n\n%s\n\nThe token expires in 24 hours.\n",
+			token),
+	}); err != nil {
+		return err
+	}
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body:    fmt.Sprintf("A request was made to change your Chirpy email address to %s. If this was not you, change your password.\n", newEmail),
+	})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+// sendEmailVerification records a new single-use verification token for user's current
+// address and mails it, replacing any token that has not been used yet
+func (cfg *Config) sendEmailVerification(ctx context.Context, user database.User) error {
+	tokenID := uuid.New()
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		if err := q.DeletePendingEmailVerificationTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		_, err := q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+			ID:        tokenID,
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(emailVerificationTTL),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeEmailVerificationToken(user.ID, tokenID, user.Email, cfg.JWTKeys, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Verify this address by sending the token below to POST /api/users/verify.\n\n%s\n\nThe token expires in 48 hours.\n",
+			token),
+	})
+}
@@ -3,17 +3,22 @@ package api
 import (
 	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"sort"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// Metrics Handlers
+// Admin Handlers
 
 func HandleOKRequest(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -54,11 +59,79 @@ func (cfg *Config) ResetDatabase(w http.ResponseWriter, req *http.Request) {
 	respondWithJSON(w, http.StatusOK, "Database reset")
 }
 
+func (cfg *Config) SetUserRole(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
+		respondWithError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+	if err := validateRole(params.Role); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	// Admins can't demote themselves, so there is always one left to fix mistakes
+	if userID == mustPrincipal(req).UserID {
+		respondWithError(w, http.StatusBadRequest, "You cannot change your own role")
+		return
+	}
+
+	rows, err := cfg.DbQueries.UpdateUserRole(req.Context(), database.UpdateUserRoleParams{
+		ID:        userID,
+		Role:      params.Role,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating role")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting user")
+		return
+	}
+	respondWithUserJSON(w, http.StatusOK, user)
+}
+
+func (cfg *Config) UnlockUser(w http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err := cfg.AccountLimiter.Reset(req.Context(), accountLockoutKey(user.Email)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error unlocking user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "User unlocked")
+}
+
 // Chirps Handlers
 
 func (cfg *Config) CreateChirp(w http.ResponseWriter, req *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string `json:"body"`
+		InReplyTo string `json:"in_reply_to"`
 	}
 
 	// Request
@@ -71,26 +144,59 @@ func (cfg *Config) CreateChirp(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Authenticate
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Missing Authorization header")
-		return
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+	if cfg.RequireEmailVerification {
+		user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+		if !user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusForbidden, "Email address not verified")
+			return
+		}
 	}
-	userID, err := auth.ValidateJWT(bearerToken, cfg.BearerToken)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User not authorized")
-		return
+
+	// Replies join the thread of the chirp they answer
+	parentID, rootID := uuid.NullUUID{}, uuid.NullUUID{}
+	if params.InReplyTo != "" {
+		id, err := uuid.Parse(params.InReplyTo)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid in_reply_to chirp ID")
+			return
+		}
+		parent, err := cfg.DbQueries.GetChirpByID(req.Context(), id)
+		if err != nil || parent.DeletedAt.Valid {
+			respondWithError(w, http.StatusNotFound, "Chirp being replied to not found")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		rootID = parent.RootID
+		if !rootID.Valid {
+			rootID = parentID
+		}
 	}
 
 	// Create chirp
 	if len(params.Body) <= 140 {
 		filteredBody := filterProfanity(params.Body)
-		chirp, err := cfg.DbQueries.CreateChirp(req.Context(), database.CreateChirpParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Body:      filteredBody,
-			UserID:    userID,
+		var chirp database.Chirp
+		err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+			var err error
+			chirp, err = q.CreateChirp(req.Context(), database.CreateChirpParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Body:      filteredBody,
+				UserID:    userID,
+				ParentID:  parentID,
+				RootID:    rootID,
+			})
+			if err != nil {
+				return err
+			}
+			return indexChirp(req.Context(), q, chirp)
 		})
 		if err != nil {
 			errMessage := fmt.Sprintf("Error creating chirp: %v", err)
@@ -98,86 +204,78 @@ func (cfg *Config) CreateChirp(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		// Response
-		type chirpResponse struct {
-			ID        uuid.UUID `json:"id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Body      string    `json:"body"`
-			UserID    uuid.UUID `json:"user_id"`
-		}
-		resp := chirpResponse{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		}
-		data, _ := json.Marshal(resp)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusCreated)
-		if _, err := w.Write(data); err != nil {
+		resp, err := cfg.chirpResponses(req.Context(), []database.Chirp{chirp}, uuid.NullUUID{UUID: userID, Valid: true})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error getting chirp")
 			return
 		}
+		respondWithPayload(w, http.StatusCreated, resp[0])
 	} else {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 	}
 }
 
 func (cfg *Config) GetChirps(w http.ResponseWriter, req *http.Request) {
-	// Get chirps
-	chirps, err := cfg.DbQueries.GetChirps(req.Context())
+	query := req.URL.Query()
+
+	// Page size, fetch one extra row to know whether another page exists
+	pageSize, err := parsePageSize(query)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error getting chirps")
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
 		return
 	}
 
 	// Filter by author if provided
-	authorID := req.URL.Query().Get("author_id")
-	if authorID != "" {
-		filteredChirps := make([]database.Chirp, 0, len(chirps))
-		for _, chirp := range chirps {
-			if chirp.UserID == uuid.MustParse(authorID) {
-				filteredChirps = append(filteredChirps, chirp)
-			}
+	authorID := uuid.NullUUID{}
+	if authorParam := query.Get("author_id"); authorParam != "" {
+		id, err := uuid.Parse(authorParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
 		}
-		chirps = filteredChirps
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
 	}
 
 	// Optional sorting by createdAt
 	// Default is ascending
-	optionalSort := req.URL.Query().Get("sort")
-	sort.Slice(chirps, func(i, j int) bool {
-		if optionalSort == "desc" {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-		}
-		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-	})
+	descending := query.Get("sort") == "desc"
 
-	// Response
-	type chirpResponse struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Body      string    `json:"body"`
-		UserID    uuid.UUID `json:"user_id"`
-	}
-	resp := make([]chirpResponse, 0, len(chirps))
-	for _, chirp := range chirps {
-		resp = append(resp, chirpResponse{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
+	// Resume after the cursor, or start from the first row in sort order
+	cursorCreatedAt, cursorID, err := parseCursor(query, descending)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Get chirps
+	var chirps []database.Chirp
+	if descending {
+		chirps, err = cfg.DbQueries.GetChirpsPageDesc(req.Context(), database.GetChirpsPageDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        pageSize + 1,
+		})
+	} else {
+		chirps, err = cfg.DbQueries.GetChirpsPageAsc(req.Context(), database.GetChirpsPageAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        pageSize + 1,
 		})
 	}
-	data, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(data); err != nil {
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirps")
+		return
+	}
+
+	chirps, nextCursor := pageChirps(chirps, pageSize)
+	resp, err := cfg.chirpResponses(req.Context(), chirps, viewerFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirps")
 		return
 	}
+	respondWithChirpsPage(w, http.StatusOK, resp, nextCursor)
 }
 
 func (cfg *Config) GetChirpByID(w http.ResponseWriter, req *http.Request) {
@@ -192,76 +290,65 @@ func (cfg *Config) GetChirpByID(w http.ResponseWriter, req *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Error getting chirp")
 		return
 	}
-
-	type chirpResponse struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Body      string    `json:"body"`
-		UserID    uuid.UUID `json:"user_id"`
-	}
-	resp := chirpResponse{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	}
-	data, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(data); err != nil {
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusGone, "Chirp deleted")
 		return
 	}
-}
 
-func (cfg *Config) DeleteChirpByID(w http.ResponseWriter, req *http.Request) {
-	// Authorization
-	bearerToken, err := auth.GetBearerToken(req.Header)
+	resp, err := cfg.chirpResponses(req.Context(), []database.Chirp{chirp}, viewerFromRequest(req))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Missing Authorization header")
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirp")
 		return
 	}
-	userID, err := auth.ValidateJWT(bearerToken, cfg.BearerToken)
+	respondWithPayload(w, http.StatusOK, resp[0])
+}
+
+func (cfg *Config) GetChirpThread(w http.ResponseWriter, req *http.Request) {
+	id, err := uuid.Parse(req.PathValue("id"))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User not authorized")
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
-	// Check for chirp ID
-	id := req.PathValue("id")
-	if id == "" {
-		respondWithError(w, http.StatusBadRequest, "Missing chirp ID")
+	// Find the root of the conversation
+	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
 		return
 	}
+	rootID := chirp.ID
+	if chirp.RootID.Valid {
+		rootID = chirp.RootID.UUID
+	}
 
-	// Verify user ownership
-	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), uuid.MustParse(id))
+	// Get every chirp in the conversation, oldest first
+	chirps, err := cfg.DbQueries.GetThreadChirps(req.Context(), rootID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Error getting chirp")
+		respondWithError(w, http.StatusInternalServerError, "Error getting thread")
 		return
 	}
-	if chirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "User not authorized")
+	resp, err := cfg.chirpResponses(req.Context(), chirps, viewerFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting thread")
 		return
 	}
-
-	// Delete chirp
-	if err := cfg.DbQueries.RemoveChirpByID(req.Context(), uuid.MustParse(id)); err != nil {
-		respondWithError(w, http.StatusNotFound, "Error deleting chirp")
+	thread := buildThread(rootID, chirps, resp)
+	if thread == nil {
+		respondWithError(w, http.StatusNotFound, "Thread not found")
 		return
 	}
 
-	respondWithJSON(w, http.StatusNoContent, "Chirp deleted")
+	respondWithPayload(w, http.StatusOK, thread)
 }
 
-// Users Handlers
+func (cfg *Config) UpdateChirp(w http.ResponseWriter, req *http.Request) {
+	// Authorization
+	principal := mustPrincipal(req)
+	userID := principal.UserID
 
-func (cfg *Config) RegisterUser(w http.ResponseWriter, req *http.Request) {
 	// Request
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Body string `json:"body"`
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
@@ -270,162 +357,2280 @@ func (cfg *Config) RegisterUser(w http.ResponseWriter, req *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, errMessage)
 		return
 	}
-
-	hashedPassword, err := auth.HashPassword(params.Password)
-	if err != nil {
-		errMessage := fmt.Sprintf("Error hashing password: %v", err)
-		respondWithError(w, http.StatusInternalServerError, errMessage)
+	if len(params.Body) > 140 {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return
 	}
 
-	// Create user
-	user, err := cfg.DbQueries.CreateUser(req.Context(), database.CreateUserParams{
-		ID:             uuid.New(),
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
+	// Check for chirp ID
+	chirpID, err := uuid.Parse(req.PathValue("id"))
 	if err != nil {
-		errMessage := fmt.Sprintf("Error creating user: %v", err)
-		respondWithError(w, http.StatusInternalServerError, errMessage)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
-	respondWithUserJSON(w, http.StatusCreated, user)
-}
-
-func (cfg *Config) LoginUser(w http.ResponseWriter, req *http.Request) {
-	// Request
-	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+	// Verify user ownership
+	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
+		return
 	}
-	decoder := json.NewDecoder(req.Body)
-	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
-		respondWithError(w, http.StatusInternalServerError, errMessage)
+	if chirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User not authorized")
 		return
 	}
-
-	// Get user
-	user, err := cfg.DbQueries.GetUserByEmail(req.Context(), params.Email)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusGone, "Chirp deleted")
 		return
 	}
 
-	// Check password
-	if !auth.CheckPasswordHash(params.Password, user.HashedPassword) {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+	// Update chirp, the previous body is kept as a revision. The row stays locked until the
+	// edit is saved, so concurrent edits each record the body the one before them left.
+	filteredBody := filterProfanity(params.Body)
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		current, err := q.GetChirpForUpdate(req.Context(), chirp.ID)
+		if err != nil {
+			return err
+		}
+		// Deleted since it was read above
+		if current.DeletedAt.Valid {
+			return sql.ErrNoRows
+		}
+		chirp = current
+		if filteredBody == current.Body {
+			return nil
+		}
+		now := time.Now()
+		if err := q.CreateChirpRevision(req.Context(), database.CreateChirpRevisionParams{
+			ID:         uuid.New(),
+			ChirpID:    current.ID,
+			Body:       current.Body,
+			CreatedAt:  current.UpdatedAt,
+			ReplacedAt: now,
+		}); err != nil {
+			return err
+		}
+		chirp, err = q.UpdateChirpBody(req.Context(), database.UpdateChirpBodyParams{
+			ID:        current.ID,
+			Body:      filteredBody,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		return indexChirp(req.Context(), q, chirp)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusGone, "Chirp deleted")
 		return
 	}
-
-	// Generate JWT accessToken, expires in 1 hour
-	accessToken, err := auth.MakeJWT(user.ID, cfg.BearerToken, 3600*time.Second)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to generate JWT")
+		respondWithError(w, http.StatusInternalServerError, "Error updating chirp")
 		return
 	}
 
-	// Generate refreshToken, expires in 60 days
-	refreshToken, err := auth.MakeRefreshToken()
-	if _, err := cfg.DbQueries.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
-	}); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to generate refresh token")
+	resp, err := cfg.chirpResponses(req.Context(), []database.Chirp{chirp}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirp")
 		return
 	}
+	respondWithPayload(w, http.StatusOK, resp[0])
+}
 
-	// Response
-	type userResponse struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-	}
-	resp := userResponse{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
-	}
-	data, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(data); err != nil {
+func (cfg *Config) GetChirpRevisions(w http.ResponseWriter, req *http.Request) {
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
-}
-
-func (cfg *Config) UpdateUser(w http.ResponseWriter, req *http.Request) {
-	// Request Header
-	token, err := auth.GetBearerToken(req.Header)
+	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Missing Authorization header")
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
 		return
 	}
-	if token == "" {
-		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusGone, "Chirp deleted")
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.BearerToken)
+
+	// Get revisions, newest first
+	revisions, err := cfg.DbQueries.GetChirpRevisions(req.Context(), chirp.ID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User not authorized")
+		respondWithError(w, http.StatusInternalServerError, "Error getting revisions")
 		return
 	}
 
-	// Request Body
-	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+	// Response
+	type revisionResponse struct {
+		ID         uuid.UUID `json:"id"`
+		Body       string    `json:"body"`
+		CreatedAt  time.Time `json:"created_at"`
+		ReplacedAt time.Time `json:"replaced_at"`
+	}
+	type revisionsResponse struct {
+		Revisions []revisionResponse `json:"revisions"`
+	}
+	resp := revisionsResponse{Revisions: make([]revisionResponse, 0, len(revisions))}
+	for _, revision := range revisions {
+		resp.Revisions = append(resp.Revisions, revisionResponse{
+			ID:         revision.ID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
 	}
-	decoder := json.NewDecoder(req.Body)
-	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
-		respondWithError(w, http.StatusInternalServerError, errMessage)
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+func (cfg *Config) DeleteChirpByID(w http.ResponseWriter, req *http.Request) {
+	// Authorization
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Check for chirp ID
+	id := req.PathValue("id")
+	if id == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing chirp ID")
 		return
 	}
 
-	// Update password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	// Verify user ownership
+	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), uuid.MustParse(id))
 	if err != nil {
-		errMessage := fmt.Sprintf("Error hashing password: %v", err)
-		respondWithError(w, http.StatusInternalServerError, errMessage)
-	}
-
-	// Update user
-	if err := cfg.DbQueries.UpdateUser(req.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		UpdatedAt:      time.Now(),
-	}); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error updating user")
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
 		return
 	}
+	if chirp.UserID != userID {
+		canModerate, err := cfg.principalCan(req.Context(), principal, PermModerateChirps)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error checking permissions")
+			return
+		}
+		if !canModerate {
+			respondWithError(w, http.StatusForbidden, "User not authorized")
+			return
+		}
+	}
 
-	// Get user
-	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	// Chirps with replies become tombstones so the thread stays connected
+	replies, err := cfg.DbQueries.CountChirpReplies(req.Context(), uuid.NullUUID{UUID: chirp.ID, Valid: true})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error getting user")
+		respondWithError(w, http.StatusInternalServerError, "Error deleting chirp")
+		return
+	}
+	if replies > 0 {
+		if err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+			if err := q.TombstoneChirpByID(req.Context(), database.TombstoneChirpByIDParams{
+				ID:        chirp.ID,
+				DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			}); err != nil {
+				return err
+			}
+			if err := q.RemoveChirpHashtags(req.Context(), chirp.ID); err != nil {
+				return err
+			}
+			return q.RemoveChirpMentions(req.Context(), chirp.ID)
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error deleting chirp")
+			return
+		}
+		respondWithJSON(w, http.StatusNoContent, "Chirp deleted")
+		return
+	}
+
+	// Delete chirp
+	if err := cfg.DbQueries.RemoveChirpByID(req.Context(), uuid.MustParse(id)); err != nil {
+		respondWithError(w, http.StatusNotFound, "Error deleting chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Chirp deleted")
+}
+
+func (cfg *Config) GetTimeline(w http.ResponseWriter, req *http.Request) {
+	// Authenticate
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Pagination, newest first
+	query := req.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	cursorCreatedAt, cursorID, err := parseCursor(query, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Get chirps and rechirps from the user and everyone they follow. A chirp that was posted and
+	// rechirped, or rechirped more than once, appears once at its newest activity.
+	rows, err := cfg.DbQueries.GetTimelinePage(req.Context(), database.GetTimelinePageParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        pageSize + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting timeline")
+		return
+	}
+
+	// Rechirps are ordered by when they were rechirped, so page on that time
+	var nextCursor *string
+	if len(rows) > int(pageSize) {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		cursor := encodeCursor(last.ActivityAt, last.ID)
+		nextCursor = &cursor
+	}
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, database.Chirp{
+			ID:           row.ID,
+			CreatedAt:    row.CreatedAt,
+			UpdatedAt:    row.UpdatedAt,
+			Body:         row.Body,
+			UserID:       row.UserID,
+			ParentID:     row.ParentID,
+			RootID:       row.RootID,
+			DeletedAt:    row.DeletedAt,
+			LikeCount:    row.LikeCount,
+			RechirpCount: row.RechirpCount,
+		})
+	}
+	chirpResps, err := cfg.chirpResponses(req.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting timeline")
+		return
+	}
+
+	// Response
+	type timelineItem struct {
+		chirpResponse
+		RechirpedBy uuid.NullUUID `json:"rechirped_by"`
+	}
+	type pageResponse struct {
+		Chirps     []timelineItem `json:"chirps"`
+		NextCursor *string        `json:"next_cursor"`
+	}
+	resp := pageResponse{
+		Chirps:     make([]timelineItem, 0, len(rows)),
+		NextCursor: nextCursor,
+	}
+	for i, row := range rows {
+		resp.Chirps = append(resp.Chirps, timelineItem{
+			chirpResponse: chirpResps[i],
+			RechirpedBy:   row.RechirpedBy,
+		})
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+// Reaction Handlers
+
+func (cfg *Config) LikeChirp(w http.ResponseWriter, req *http.Request) {
+	cfg.reactToChirp(w, req, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.DbQueries.LikeChirp(ctx, database.LikeChirpParams{
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+func (cfg *Config) UnlikeChirp(w http.ResponseWriter, req *http.Request) {
+	cfg.reactToChirp(w, req, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.DbQueries.UnlikeChirp(ctx, database.UnlikeChirpParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+	})
+}
+
+func (cfg *Config) Rechirp(w http.ResponseWriter, req *http.Request) {
+	cfg.reactToChirp(w, req, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.DbQueries.CreateRechirp(ctx, database.CreateRechirpParams{
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+func (cfg *Config) UndoRechirp(w http.ResponseWriter, req *http.Request) {
+	cfg.reactToChirp(w, req, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.DbQueries.RemoveRechirp(ctx, database.RemoveRechirpParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+	})
+}
+
+// reactToChirp applies a like or rechirp change for the authenticated user and responds with the updated chirp.
+// The queries only move the counters when a row is actually added or removed, so repeats are no-ops.
+func (cfg *Config) reactToChirp(w http.ResponseWriter, req *http.Request, react func(ctx context.Context, userID, chirpID uuid.UUID) error) {
+	// Authenticate
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Check for chirp ID
+	chirpID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+	chirp, err := cfg.DbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
+		return
+	}
+
+	if err := react(req.Context(), userID, chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating chirp")
+		return
+	}
+
+	// Response with fresh counters
+	chirp, err = cfg.DbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Error getting chirp")
+		return
+	}
+	resp, err := cfg.chirpResponses(req.Context(), []database.Chirp{chirp}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirp")
+		return
+	}
+	respondWithPayload(w, http.StatusOK, resp[0])
+}
+
+// Search Handlers
+
+func (cfg *Config) SearchChirps(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	searchQuery := buildSearchQuery(query.Get("q"))
+	if searchQuery == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	// Pagination, most relevant first
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	cursorRank, cursorID, err := parseRankCursor(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Filter by author if provided
+	authorID := uuid.NullUUID{}
+	if authorParam := query.Get("author_id"); authorParam != "" {
+		id, err := uuid.Parse(authorParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	// Search chirps
+	rows, err := cfg.DbQueries.SearchChirps(req.Context(), database.SearchChirpsParams{
+		Query:      searchQuery,
+		AuthorID:   authorID,
+		CursorRank: cursorRank,
+		CursorID:   cursorID,
+		PageSize:   pageSize + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error searching chirps")
+		return
+	}
+
+	var nextCursor *string
+	if len(rows) > int(pageSize) {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		cursor := encodeRankCursor(last.Rank, last.ID)
+		nextCursor = &cursor
+	}
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, database.Chirp{
+			ID:           row.ID,
+			CreatedAt:    row.CreatedAt,
+			UpdatedAt:    row.UpdatedAt,
+			Body:         row.Body,
+			UserID:       row.UserID,
+			ParentID:     row.ParentID,
+			RootID:       row.RootID,
+			DeletedAt:    row.DeletedAt,
+			LikeCount:    row.LikeCount,
+			RechirpCount: row.RechirpCount,
+		})
+	}
+	resp, err := cfg.chirpResponses(req.Context(), chirps, viewerFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error searching chirps")
+		return
+	}
+	respondWithChirpsPage(w, http.StatusOK, resp, nextCursor)
+}
+
+// Hashtag Handlers
+
+func (cfg *Config) GetHashtagChirps(w http.ResponseWriter, req *http.Request) {
+	tag := normalizeHashtag(req.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing hashtag")
+		return
+	}
+
+	// Pagination, newest first
+	query := req.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	cursorCreatedAt, cursorID, err := parseCursor(query, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Get chirps
+	chirps, err := cfg.DbQueries.GetHashtagChirpsPage(req.Context(), database.GetHashtagChirpsPageParams{
+		Tag:             tag,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        pageSize + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirps")
+		return
+	}
+
+	chirps, nextCursor := pageChirps(chirps, pageSize)
+	resp, err := cfg.chirpResponses(req.Context(), chirps, viewerFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting chirps")
+		return
+	}
+	respondWithChirpsPage(w, http.StatusOK, resp, nextCursor)
+}
+
+func (cfg *Config) GetTrendingHashtags(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	// Sliding window, defaults to the last day and is capped at a week
+	window := 24 * time.Hour
+	if windowParam := query.Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 || parsed > 7*24*time.Hour {
+			respondWithError(w, http.StatusBadRequest, "Invalid window")
+			return
+		}
+		window = parsed
+	}
+	limit, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+
+	// Get hashtags used in the most chirps during the window
+	trending, err := cfg.DbQueries.GetTrendingHashtags(req.Context(), database.GetTrendingHashtagsParams{
+		Since:    time.Now().Add(-window),
+		PageSize: limit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting trending hashtags")
+		return
+	}
+
+	// Response
+	type hashtagResponse struct {
+		Tag        string `json:"tag"`
+		ChirpCount int64  `json:"chirp_count"`
+	}
+	type trendingResponse struct {
+		Window   string            `json:"window"`
+		Hashtags []hashtagResponse `json:"hashtags"`
+	}
+	resp := trendingResponse{
+		Window:   window.String(),
+		Hashtags: make([]hashtagResponse, 0, len(trending)),
+	}
+	for _, hashtag := range trending {
+		resp.Hashtags = append(resp.Hashtags, hashtagResponse{
+			Tag:        hashtag.Tag,
+			ChirpCount: hashtag.ChirpCount,
+		})
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+// Users Handlers
+
+func (cfg *Config) RegisterUser(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Password    string `json:"password"`
+		Email       string `json:"email"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarURL   string `json:"avatar_url"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
+		respondWithError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	// Validate email and public profile
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Handle != "" {
+		if err := validateHandle(params.Handle); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := validateProfile(params.DisplayName, params.Bio, params.AvatarURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := cfg.checkPassword(params.Password, params.Email, params.Handle, params.DisplayName); err != nil {
+		respondWithPasswordError(w, err, "password")
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		errMessage := fmt.Sprintf("Error hashing password: %v", err)
+		respondWithError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	// Create user
+	user, err := cfg.DbQueries.CreateUser(req.Context(), database.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Email:          params.Email,
+		HashedPassword: hashedPassword,
+		Handle:         nullableHandle(params.Handle),
+		DisplayName:    params.DisplayName,
+		Bio:            params.Bio,
+		AvatarUrl:      params.AvatarURL,
+	})
+	if err != nil {
+		respondWithUserError(w, userConflict(err), fmt.Sprintf("Error creating user: %v", err))
+		return
+	}
+
+	// The account exists either way, a lost email can be sent again
+	if err := cfg.sendEmailVerification(req.Context(), user); err != nil {
+		log.Printf("Error sending email verification to user %s: %v", user.ID, err)
+	}
+
+	respondWithUserJSON(w, http.StatusCreated, user)
+}
+
+func (cfg *Config) GetUserProfile(w http.ResponseWriter, req *http.Request) {
+	user, err := cfg.DbQueries.GetUserByHandle(req.Context(), req.PathValue("handle"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	stats, err := cfg.DbQueries.GetUserProfileStats(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting profile")
+		return
+	}
+
+	// Response, only public fields
+	type profileResponse struct {
+		ID             uuid.UUID `json:"id"`
+		Handle         string    `json:"handle"`
+		DisplayName    string    `json:"display_name"`
+		Bio            string    `json:"bio"`
+		AvatarURL      string    `json:"avatar_url"`
+		IsChirpyRed    bool      `json:"is_chirpy_red"`
+		CreatedAt      time.Time `json:"created_at"`
+		ChirpCount     int64     `json:"chirp_count"`
+		FollowerCount  int64     `json:"follower_count"`
+		FollowingCount int64     `json:"following_count"`
+	}
+	respondWithPayload(w, http.StatusOK, profileResponse{
+		ID:             user.ID,
+		Handle:         user.Handle.String,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarUrl,
+		IsChirpyRed:    user.IsChirpyRed,
+		CreatedAt:      user.CreatedAt,
+		ChirpCount:     stats.ChirpCount,
+		FollowerCount:  stats.FollowerCount,
+		FollowingCount: stats.FollowingCount,
+	})
+}
+
+func (cfg *Config) LoginUser(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
+		respondWithError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+
+	// Throttle guessing, a locked account stays locked even for the right password
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), params.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait)
+		return
+	}
+
+	// Get user, unknown emails count as failures too so they can't be told apart
+	user, err := cfg.DbQueries.GetUserByEmail(req.Context(), params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+		return
+	}
+
+	// Check password
+	if !auth.CheckPasswordHash(params.Password, user.HashedPassword) {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+		return
+	}
+	cfg.upgradePasswordHash(req.Context(), user, params.Password)
+
+	// Two-factor accounts get a short-lived challenge token to exchange at /api/login/2fa.
+	// Their failures are only cleared once the code is right as well.
+	if user.TotpEnabledAt.Valid {
+		cfg.releaseLoginAttempt(req.Context(), params.Email, ip)
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.recordLoginSuccess(req.Context(), params.Email, ip)
+	cfg.respondWithLogin(w, req, user)
+}
+
+func (cfg *Config) LoginTwoFactor(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	userID, err := auth.ValidateMFAToken(params.MFAToken, cfg.JWTKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	// Codes are throttled on the same counters as passwords
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), user.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait)
+		return
+	}
+
+	// Check second factor
+	ok, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking code")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	}
+
+	cfg.recordLoginSuccess(req.Context(), user.Email, ip)
+	cfg.respondWithLogin(w, req, user)
+}
+
+func (cfg *Config) LoginOIDC(w http.ResponseWriter, req *http.Request) {
+	if cfg.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+	state, nonce, verifier, err := cfg.startOIDCLogin(req.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error starting login")
+		return
+	}
+
+	setOIDCStateCookie(w, req, state, int(oidcStateTTL.Seconds()))
+	http.Redirect(w, req, cfg.OIDC.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+func (cfg *Config) LoginOIDCCallback(w http.ResponseWriter, req *http.Request) {
+	if cfg.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+	query := req.URL.Query()
+
+	// The state must be the one this browser was sent off with
+	state := query.Get("state")
+	cookie, err := req.Cookie(oidcStateCookie)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired login state")
+		return
+	}
+	setOIDCStateCookie(w, req, "", -1)
+	login, err := cfg.consumeOIDCLogin(req.Context(), state)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired login state")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login state")
+		return
+	}
+
+	if query.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, "Sign in was cancelled or denied by the provider")
+		return
+	}
+	idToken, err := cfg.OIDC.Authenticate(req.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Error completing OIDC login: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Sign in with the provider failed")
+		return
+	}
+
+	user, err := cfg.userForIdentity(req.Context(), req, idToken)
+	switch {
+	case errors.Is(err, errOIDCNoEmail):
+		respondWithError(w, http.StatusForbidden, "The provider did not share a usable email address")
+		return
+	case errors.Is(err, errOIDCEmailNotLinkable):
+		respondWithError(w, http.StatusConflict, "An account with this email already exists, sign in with its password")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Error signing in")
+		return
+	}
+
+	// The provider stands in for the password, a second factor is still asked for
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+	cfg.respondWithLogin(w, req, user)
+}
+
+func (cfg *Config) UpdateUser(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Body
+	type parameters struct {
+		Password        string `json:"password"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+		profileFields
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
+		respondWithError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+	if params.Password == "" || params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email and password are required, use PATCH for partial updates")
+		return
+	}
+
+	// Profile fields left out of the request keep their current values
+	current, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	update, err := params.profileFields.apply(current)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Replacing the credentials needs the current password, as it does with PATCH
+	if params.CurrentPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Current password is required to change email or password")
+		return
+	}
+	// Throttled on the same counters as logins, like the check for deleting the account
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), current.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait)
+		return
+	}
+	if !auth.CheckPasswordHash(params.CurrentPassword, current.HashedPassword) {
+		respondWithError(w, http.StatusForbidden, "Current password is incorrect")
+		return
+	}
+	cfg.recordLoginSuccess(req.Context(), current.Email, ip)
+
+	// Update password, checked against the email the account is moving to as well as the current one
+	if err := cfg.checkPassword(params.Password, params.Email, current.Email, update.Handle.String, update.DisplayName); err != nil {
+		respondWithPasswordError(w, err, "password")
+		return
+	}
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		errMessage := fmt.Sprintf("Error hashing password: %v", err)
+		respondWithError(w, http.StatusInternalServerError, errMessage)
+		return
+	}
+	update.HashedPassword = hashedPassword
+
+	// A new email address is only written once it has been verified
+	emailChanged := params.Email != current.Email
+	if emailChanged {
+		if err := validateEmail(params.Email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := cfg.DbQueries.GetUserByEmail(req.Context(), params.Email); err == nil {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+	}
+
+	// Update user
+	user, err := saveUser(req.Context(), cfg.DbQueries, update)
+	if err != nil {
+		respondWithUserError(w, err, "Error updating user")
+		return
+	}
+	if !emailChanged {
+		respondWithUserJSON(w, http.StatusOK, user)
+		return
+	}
+
+	if err := cfg.requestEmailChange(req.Context(), user, params.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error sending email verification")
+		return
+	}
+	respondWithUserJSON(w, http.StatusAccepted, user)
+}
+
+func (cfg *Config) PatchUser(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Body, only supplied fields are changed
+	type parameters struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		profileFields
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		errMessage := fmt.Sprintf("Error decoding parameters: %v", err)
+		respondWithError(w, http.StatusBadRequest, errMessage)
+		return
+	}
+
+	current, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	update, err := params.profileFields.apply(current)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Credential changes need a login and the current password
+	emailChanged := params.Email != nil && *params.Email != current.Email
+	if emailChanged || params.Password != nil {
+		if !principal.HasScope(ScopeAccount) {
+			respondWithAuthError(w, &scopeError{scope: ScopeAccount})
+			return
+		}
+		if params.CurrentPassword == "" {
+			respondWithError(w, http.StatusBadRequest, "Current password is required to change email or password")
+			return
+		}
+		ip := clientIP(req)
+		wait, err := cfg.reserveLoginAttempt(req.Context(), current.Email, ip)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+			return
+		}
+		if wait > 0 {
+			respondWithTooManyAttempts(w, wait)
+			return
+		}
+		if !auth.CheckPasswordHash(params.CurrentPassword, current.HashedPassword) {
+			respondWithError(w, http.StatusForbidden, "Current password is incorrect")
+			return
+		}
+		cfg.recordLoginSuccess(req.Context(), current.Email, ip)
+	}
+	if params.Password != nil {
+		email := current.Email
+		if emailChanged {
+			email = *params.Email
+		}
+		if err := cfg.checkPassword(*params.Password, email, current.Email, update.Handle.String, update.DisplayName); err != nil {
+			respondWithPasswordError(w, err, "password")
+			return
+		}
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			errMessage := fmt.Sprintf("Error hashing password: %v", err)
+			respondWithError(w, http.StatusInternalServerError, errMessage)
+			return
+		}
+		update.HashedPassword = hashedPassword
+	}
+
+	// A new email address is only written once it has been verified
+	if emailChanged {
+		if err := validateEmail(*params.Email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := cfg.DbQueries.GetUserByEmail(req.Context(), *params.Email); err == nil {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+	}
+
+	user, err := saveUser(req.Context(), cfg.DbQueries, update)
+	if err != nil {
+		respondWithUserError(w, err, "Error updating user")
+		return
+	}
+	if !emailChanged {
+		respondWithUserJSON(w, http.StatusOK, user)
+		return
+	}
+
+	if err := cfg.requestEmailChange(req.Context(), user, *params.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error sending email verification")
+		return
+	}
+	respondWithUserJSON(w, http.StatusAccepted, user)
+}
+
+func (cfg *Config) VerifyEmailChange(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil || params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	var user database.User
+	err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		change, err := q.UseEmailChangeToken(req.Context(), database.UseEmailChangeTokenParams{
+			TokenHash: auth.HashToken(params.Token),
+			UsedAt:    sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		current, err := q.GetUserByID(req.Context(), change.UserID)
+		if err != nil {
+			return err
+		}
+		update, err := profileFields{}.apply(current)
+		if err != nil {
+			return err
+		}
+		update.Email = change.NewEmail
+		if _, err := saveUser(req.Context(), q, update); err != nil {
+			return err
+		}
+
+		// Following the emailed token proves the new address
+		if err := q.SetUserEmailVerified(req.Context(), database.SetUserEmailVerifiedParams{
+			ID:              change.UserID,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}); err != nil {
+			return err
+		}
+		user, err = q.GetUserByID(req.Context(), change.UserID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		respondWithUserError(w, err, "Error verifying email")
+		return
+	}
+
+	respondWithUserJSON(w, http.StatusOK, user)
+}
+
+func (cfg *Config) VerifyEmail(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil || params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+	userID, tokenID, email, err := auth.ValidateEmailVerificationToken(params.Token, cfg.JWTKeys)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	// Tokens are single use and only count for the address they were sent to
+	var user database.User
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		if _, err := q.UseEmailVerificationToken(req.Context(), database.UseEmailVerificationTokenParams{
+			ID:     tokenID,
+			UsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}); err != nil {
+			return err
+		}
+		current, err := q.GetUserByID(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if current.Email != email {
+			return sql.ErrNoRows
+		}
+		if !current.EmailVerifiedAt.Valid {
+			if err := q.SetUserEmailVerified(req.Context(), database.SetUserEmailVerifiedParams{
+				ID:              userID,
+				EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+		user, err = q.GetUserByID(req.Context(), userID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying email")
+		return
+	}
+
+	respondWithUserJSON(w, http.StatusOK, user)
+}
+
+func (cfg *Config) ResendEmailVerification(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email address already verified")
+		return
+	}
+	if err := cfg.sendEmailVerification(req.Context(), user); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error sending email verification")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Verification email sent")
+}
+
+func (cfg *Config) SetupTwoFactor(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	// Store a pending secret, it only takes effect once a code from it is confirmed
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating secret")
+		return
+	}
+	if err := cfg.DbQueries.SetUserTOTPSecret(req.Context(), database.SetUserTOTPSecretParams{
+		ID:         userID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error starting two-factor setup")
+		return
+	}
+
+	account := user.Email
+	if user.Handle.Valid {
+		account = user.Handle.String
+	}
+	type setupResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+	respondWithPayload(w, http.StatusOK, setupResponse{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, "Chirpy", account),
+	})
+}
+
+func (cfg *Config) ConfirmTwoFactor(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Body
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !user.TotpSecret.Valid || user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor setup has not been started")
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Incorrect code")
+		return
+	}
+
+	// Enable and hand out recovery codes, they are only ever shown here
+	var codes []string
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		rows, err := q.EnableUserTOTP(req.Context(), database.EnableUserTOTPParams{
+			ID:            userID,
+			TotpEnabledAt: sql.NullTime{Time: time.Now(), Valid: true},
+			TotpLastStep:  step,
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+		codes, err = replaceRecoveryCodes(req.Context(), q, userID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Two-factor setup has not been started")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication")
+		return
+	}
+
+	type confirmResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithPayload(w, http.StatusOK, confirmResponse{RecoveryCodes: codes})
+}
+
+func (cfg *Config) DisableTwoFactor(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Body, both the password and a second factor are needed
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+
+	// Throttled on the same counters as logins, so a stolen access token can't be used to guess
+	// the password or the codes
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), user.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait)
+		return
+	}
+	if !auth.CheckPasswordHash(params.Password, user.HashedPassword) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+		return
+	}
+	ok, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking code")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+		return
+	}
+	cfg.recordLoginSuccess(req.Context(), user.Email, ip)
+
+	if err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		if err := q.DisableUserTOTP(req.Context(), database.DisableUserTOTPParams{ID: userID, UpdatedAt: time.Now()}); err != nil {
+			return err
+		}
+		return q.DeleteRecoveryCodes(req.Context(), userID)
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Two-factor authentication disabled")
+}
+
+func (cfg *Config) DeleteUser(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Body, the password confirms the deletion, along with a second factor when enabled
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.DeleteAfter.Valid {
+		respondWithError(w, http.StatusConflict, "Account is already scheduled for deletion")
+		return
+	}
+
+	// A stolen access token must not become a way to guess the password, so the check is
+	// throttled on the same counters as logins
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), user.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking login attempts")
+		return
+	}
+	if wait > 0 {
+		respondWithTooManyAttempts(w, wait)
+		return
+	}
+	if !auth.CheckPasswordHash(params.Password, user.HashedPassword) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		ok, err := cfg.checkSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error checking code")
+			return
+		}
+		if !ok {
+			respondWithError(w, http.StatusForbidden, "Incorrect password or code")
+			return
+		}
+	}
+	cfg.recordLoginSuccess(req.Context(), user.Email, ip)
+
+	// The account stays restorable for the grace period, then the purge deletes it for good
+	user, err = cfg.scheduleAccountDeletion(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error scheduling account deletion")
+		return
+	}
+	cfg.logSecurityEvent(req.Context(), req, userID, securityEventDeletionScheduled, "")
+	if err := cfg.sendAccountDeletionNotice(req.Context(), user); err != nil {
+		log.Printf("Error sending account deletion notice to %s: %v", user.Email, err)
+	}
+
+	respondWithUserJSON(w, http.StatusAccepted, user)
+}
+
+func (cfg *Config) CancelUserDeletion(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	rows, err := cfg.DbQueries.CancelUserDeletion(req.Context(), database.CancelUserDeletionParams{
+		ID:        userID,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error cancelling account deletion")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusConflict, "Account is not scheduled for deletion")
+		return
+	}
+	cfg.logSecurityEvent(req.Context(), req, userID, securityEventDeletionCancelled, "")
+
+	user, err := cfg.DbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
 		return
 	}
-
 	respondWithUserJSON(w, http.StatusOK, user)
 }
 
+func (cfg *Config) ExportUserData(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Request Query, a ZIP of JSON files unless a single JSON document is asked for
+	format := req.URL.Query().Get("format")
+	if format != "" && format != "zip" && format != "json" {
+		respondWithError(w, http.StatusBadRequest, "format must be zip or json")
+		return
+	}
+
+	export, err := cfg.exportUser(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error exporting data")
+		return
+	}
+	cfg.logSecurityEvent(req.Context(), req, userID, securityEventDataExported, format)
+
+	// Response
+	filename := "chirpy-export-" + export.ExportedAt.UTC().Format("20060102")
+	w.Header().Set("Cache-Control", "no-store")
+	if format == "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		respondWithPayload(w, http.StatusOK, export)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	w.WriteHeader(http.StatusOK)
+	// The status is already sent, a failure part way can only be logged
+	if err := writeExportZip(w, export); err != nil {
+		log.Printf("Error writing data export for user %s: %v", userID, err)
+	}
+}
+
+func (cfg *Config) GetUserMentions(w http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Pagination, newest first
+	query := req.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	cursorCreatedAt, cursorID, err := parseCursor(query, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Get chirps mentioning the user
+	chirps, err := cfg.DbQueries.GetMentioningChirpsPage(req.Context(), database.GetMentioningChirpsPageParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageSize:        pageSize + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting mentions")
+		return
+	}
+
+	chirps, nextCursor := pageChirps(chirps, pageSize)
+	resp, err := cfg.chirpResponses(req.Context(), chirps, viewerFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting mentions")
+		return
+	}
+	respondWithChirpsPage(w, http.StatusOK, resp, nextCursor)
+}
+
+// Follow Handlers
+
+func (cfg *Config) FollowUser(w http.ResponseWriter, req *http.Request) {
+	// Authenticate
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Check for user ID
+	followeeID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if followeeID == userID {
+		respondWithError(w, http.StatusBadRequest, "Users cannot follow themselves")
+		return
+	}
+	if _, err := cfg.DbQueries.GetUserByID(req.Context(), followeeID); err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Follow user, following twice is a no-op
+	if err := cfg.DbQueries.CreateFollow(req.Context(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error following user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "User followed")
+}
+
+func (cfg *Config) UnfollowUser(w http.ResponseWriter, req *http.Request) {
+	// Authenticate
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	// Check for user ID
+	followeeID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Unfollow user
+	if err := cfg.DbQueries.RemoveFollow(req.Context(), database.RemoveFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error unfollowing user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "User unfollowed")
+}
+
+func (cfg *Config) GetFollowers(w http.ResponseWriter, req *http.Request) {
+	cfg.listFollows(w, req, true)
+}
+
+func (cfg *Config) GetFollowing(w http.ResponseWriter, req *http.Request) {
+	cfg.listFollows(w, req, false)
+}
+
+// listFollows pages through the followers or followed users of the user in the path, newest first
+func (cfg *Config) listFollows(w http.ResponseWriter, req *http.Request, followers bool) {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Pagination
+	query := req.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	cursorCreatedAt, cursorID, err := parseCursor(query, true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	// Get follows, both queries return the same row shape
+	var follows []database.GetFollowersPageRow
+	if followers {
+		follows, err = cfg.DbQueries.GetFollowersPage(req.Context(), database.GetFollowersPageParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        pageSize + 1,
+		})
+	} else {
+		var following []database.GetFollowingPageRow
+		following, err = cfg.DbQueries.GetFollowingPage(req.Context(), database.GetFollowingPageParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageSize:        pageSize + 1,
+		})
+		for _, row := range following {
+			follows = append(follows, database.GetFollowersPageRow(row))
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting follows")
+		return
+	}
+
+	// Response
+	type followResponse struct {
+		ID          uuid.UUID `json:"id"`
+		Handle      string    `json:"handle"`
+		DisplayName string    `json:"display_name"`
+		FollowedAt  time.Time `json:"followed_at"`
+	}
+	type pageResponse struct {
+		Users      []followResponse `json:"users"`
+		NextCursor *string          `json:"next_cursor"`
+	}
+	resp := pageResponse{}
+	hasMore := len(follows) > int(pageSize)
+	if hasMore {
+		follows = follows[:pageSize]
+	}
+	resp.Users = make([]followResponse, 0, len(follows))
+	for _, follow := range follows {
+		resp.Users = append(resp.Users, followResponse{
+			ID:          follow.UserID,
+			Handle:      follow.Handle.String,
+			DisplayName: follow.DisplayName,
+			FollowedAt:  follow.CreatedAt,
+		})
+	}
+	if hasMore {
+		last := resp.Users[len(resp.Users)-1]
+		cursor := encodeCursor(last.FollowedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+// Session Handlers
+
+func (cfg *Config) ListSessions(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	sessions, err := cfg.DbQueries.GetUserSessions(req.Context(), database.GetUserSessionsParams{
+		UserID:    userID,
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting sessions")
+		return
+	}
+
+	// Response
+	type sessionResponse struct {
+		ID         uuid.UUID `json:"id"`
+		UserAgent  string    `json:"user_agent"`
+		IPAddress  string    `json:"ip_address"`
+		SignedInAt time.Time `json:"signed_in_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		Current    bool      `json:"current"`
+	}
+	current := principal.SessionID
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         session.FamilyID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			SignedInAt: session.SignedInAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    current.Valid && current.UUID == session.FamilyID,
+		})
+	}
+	type sessionsResponse struct {
+		Sessions []sessionResponse `json:"sessions"`
+	}
+	respondWithPayload(w, http.StatusOK, sessionsResponse{Sessions: resp})
+}
+
+func (cfg *Config) RevokeSession(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+	sessionID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	// Only the user's own live sessions can be found
+	refreshToken, err := cfg.DbQueries.GetSessionRefreshToken(req.Context(), database.GetSessionRefreshTokenParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err := cfg.DbQueries.RevokeRefreshToken(req.Context(), database.RevokeRefreshTokenParams{
+		TokenHash: refreshToken.TokenHash,
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Session revoked")
+}
+
+func (cfg *Config) RevokeOtherSessions(w http.ResponseWriter, req *http.Request) {
+	// Request Header
+	principal := mustPrincipal(req)
+	userID := principal.UserID
+
+	sessions, err := cfg.DbQueries.GetUserSessions(req.Context(), database.GetUserSessionsParams{
+		UserID:    userID,
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting sessions")
+		return
+	}
+
+	// Revoke every session but the one making this request
+	current := principal.SessionID
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		for _, session := range sessions {
+			if current.Valid && current.UUID == session.FamilyID {
+				continue
+			}
+			if err := q.RevokeRefreshToken(req.Context(), database.RevokeRefreshTokenParams{
+				TokenHash: session.TokenHash,
+				RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Sessions revoked")
+}
+
+// Token Handlers
+
+func (cfg *Config) CreatePersonalAccessToken(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+
+	// Request
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	scopes, err := validateTokenRequest(params.Name, params.Scopes, params.ExpiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Only the hash is stored, the token itself is shown once in this response
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *params.ExpiresAt, Valid: true}
+	}
+	pat, err := cfg.DbQueries.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		UserID:    principal.UserID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating token")
+		return
+	}
+
+	resp := newPersonalAccessTokenResponse(pat)
+	resp.Token = token
+	respondWithPayload(w, http.StatusCreated, resp)
+}
+
+func (cfg *Config) ListPersonalAccessTokens(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+
+	pats, err := cfg.DbQueries.GetUserPersonalAccessTokens(req.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting tokens")
+		return
+	}
+
+	// Response
+	type tokensResponse struct {
+		Tokens []personalAccessTokenResponse `json:"tokens"`
+	}
+	resp := tokensResponse{Tokens: make([]personalAccessTokenResponse, 0, len(pats))}
+	for _, pat := range pats {
+		resp.Tokens = append(resp.Tokens, newPersonalAccessTokenResponse(pat))
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+func (cfg *Config) DeletePersonalAccessToken(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+	tokenID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	rows, err := cfg.DbQueries.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{
+		ID:        tokenID,
+		UserID:    principal.UserID,
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking token")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Token revoked")
+}
+
+// OAuth Handlers
+
+func (cfg *Config) RegisterOAuthClient(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+
+	// Request
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateClientRequest(params.Name, params.RedirectURIs); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Confidential clients get a secret, shown once like a personal access token
+	var secret string
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		var err error
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error generating client secret")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	client, err := cfg.DbQueries.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.New(),
+		UserID:       principal.UserID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error registering client")
+		return
+	}
+
+	resp := newOAuthClientResponse(client)
+	resp.ClientSecret = secret
+	respondWithPayload(w, http.StatusCreated, resp)
+}
+
+func (cfg *Config) ListOAuthClients(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+
+	clients, err := cfg.DbQueries.GetUserOAuthClients(req.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error getting clients")
+		return
+	}
+
+	// Response
+	type clientsResponse struct {
+		Clients []oauthClientResponse `json:"clients"`
+	}
+	resp := clientsResponse{Clients: make([]oauthClientResponse, 0, len(clients))}
+	for _, client := range clients {
+		resp.Clients = append(resp.Clients, newOAuthClientResponse(client))
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
+func (cfg *Config) DeleteOAuthClient(w http.ResponseWriter, req *http.Request) {
+	principal := mustPrincipal(req)
+
+	clientID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+	// Codes and grants go with the client, so every token it holds stops working
+	rows, err := cfg.DbQueries.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting client")
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Client deleted")
+}
+
+func (cfg *Config) OAuthAuthorizePage(w http.ResponseWriter, req *http.Request) {
+	ar := newAuthorizeRequest(req.URL.Query())
+	client, redirectURI, scopes, authErr := cfg.validateAuthorizeRequest(req.Context(), ar)
+	if authErr != nil {
+		if authErr.redirect {
+			redirectWithAuthorizeError(w, req, redirectURI, ar.State, authErr)
+			return
+		}
+		renderConsentPage(w, http.StatusBadRequest, consentPage{Error: authErr.description})
+		return
+	}
+
+	renderConsentPage(w, http.StatusOK, consentPage{
+		ClientName: client.Name,
+		Scopes:     describeScopes(scopes),
+		Request:    ar,
+	})
+}
+
+func (cfg *Config) OAuthAuthorize(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		renderConsentPage(w, http.StatusBadRequest, consentPage{Error: "Invalid form"})
+		return
+	}
+	ar := newAuthorizeRequest(req.PostForm)
+	client, redirectURI, scopes, authErr := cfg.validateAuthorizeRequest(req.Context(), ar)
+	if authErr != nil {
+		if authErr.redirect {
+			redirectWithAuthorizeError(w, req, redirectURI, ar.State, authErr)
+			return
+		}
+		renderConsentPage(w, http.StatusBadRequest, consentPage{Error: authErr.description})
+		return
+	}
+
+	if req.PostFormValue("action") != "approve" {
+		redirectWithAuthorizeError(w, req, redirectURI, ar.State, &authorizeError{
+			code:        oauthAccessDenied,
+			description: "The user denied the request",
+		})
+		return
+	}
+
+	// The user signs in on the consent page itself, with the same throttling as /api/login
+	email := req.PostFormValue("email")
+	page := consentPage{ClientName: client.Name, Scopes: describeScopes(scopes), Request: ar, Email: email}
+	ip := clientIP(req)
+	wait, err := cfg.reserveLoginAttempt(req.Context(), email, ip)
+	if err != nil {
+		page.Error = "Something went wrong, try again"
+		renderConsentPage(w, http.StatusInternalServerError, page)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		page.Error = "Too many failed login attempts, try again later"
+		renderConsentPage(w, http.StatusTooManyRequests, page)
+		return
+	}
+	user, err := cfg.DbQueries.GetUserByEmail(req.Context(), email)
+	if err != nil || !auth.CheckPasswordHash(req.PostFormValue("password"), user.HashedPassword) {
+		page.Error = "Incorrect email or password"
+		renderConsentPage(w, http.StatusUnauthorized, page)
+		return
+	}
+	cfg.upgradePasswordHash(req.Context(), user, req.PostFormValue("password"))
+	if user.TotpEnabledAt.Valid {
+		code, recoveryCode := req.PostFormValue("code"), ""
+		if strings.Contains(code, "-") {
+			code, recoveryCode = "", code
+		}
+		ok, err := cfg.checkSecondFactor(req.Context(), user, code, recoveryCode)
+		if err != nil {
+			page.Error = "Something went wrong, try again"
+			renderConsentPage(w, http.StatusInternalServerError, page)
+			return
+		}
+		if !ok {
+			page.Error = "Enter a valid authentication or recovery code"
+			renderConsentPage(w, http.StatusUnauthorized, page)
+			return
+		}
+	}
+	cfg.recordLoginSuccess(req.Context(), email, ip)
+
+	// Only the hash of the code is stored, the client redeems it at /oauth/token
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		redirectWithAuthorizeError(w, req, redirectURI, ar.State, &authorizeError{code: oauthServerError, description: "Failed to generate code"})
+		return
+	}
+	now := time.Now()
+	if err := cfg.DbQueries.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectUri:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: ar.CodeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(oauthCodeTTL),
+	}); err != nil {
+		redirectWithAuthorizeError(w, req, redirectURI, ar.State, &authorizeError{code: oauthServerError, description: "Failed to store code"})
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if ar.State != "" {
+		params.Set("state", ar.State)
+	}
+	redirectToClient(w, req, redirectURI, params)
+}
+
+func (cfg *Config) OAuthToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Invalid form")
+		return
+	}
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, "Client authentication failed")
+		return
+	}
+
+	now := time.Now()
+	switch req.PostFormValue("grant_type") {
+	case "authorization_code":
+		// Codes work once, even a failed exchange uses them up
+		codeHash := auth.HashToken(req.PostFormValue("code"))
+		code, err := cfg.DbQueries.UseOAuthAuthorizationCode(req.Context(), database.UseOAuthAuthorizationCodeParams{
+			CodeHash: codeHash,
+			UsedAt:   sql.NullTime{Time: now, Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			if used, err := cfg.DbQueries.GetOAuthAuthorizationCode(req.Context(), codeHash); err == nil && used.GrantID.Valid {
+				cfg.revokeReplayedOAuthGrant(req, used.GrantID.UUID, "authorization code")
+			}
+		}
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid authorization code")
+			return
+		}
+		if code.ClientID != client.ID || code.ExpiresAt.Before(now) || code.RedirectUri != req.PostFormValue("redirect_uri") {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid authorization code")
+			return
+		}
+		if !auth.VerifyPKCE(req.PostFormValue("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Code verifier does not match")
+			return
+		}
+
+		refreshToken, err := auth.MakeRefreshToken()
+		if err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to generate refresh token")
+			return
+		}
+		// The code remembers its grant, so replaying it can revoke the grant
+		var grant database.OauthGrant
+		err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+			var err error
+			grant, err = q.CreateOAuthGrant(req.Context(), database.CreateOAuthGrantParams{
+				ID:               uuid.New(),
+				ClientID:         client.ID,
+				UserID:           code.UserID,
+				Scopes:           code.Scopes,
+				RefreshTokenHash: auth.HashToken(refreshToken),
+				CreatedAt:        now,
+				RefreshExpiresAt: now.Add(refreshTokenTTL),
+				LastUsedAt:       now,
+			})
+			if err != nil {
+				return err
+			}
+			return q.SetOAuthAuthorizationCodeGrant(req.Context(), database.SetOAuthAuthorizationCodeGrantParams{
+				CodeHash: codeHash,
+				GrantID:  uuid.NullUUID{UUID: grant.ID, Valid: true},
+			})
+		})
+		if err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to create grant")
+			return
+		}
+		cfg.respondWithOAuthTokens(w, grant, refreshToken)
+
+	case "refresh_token":
+		currentHash := auth.HashToken(req.PostFormValue("refresh_token"))
+		grant, err := cfg.DbQueries.GetOAuthGrantByRefreshToken(req.Context(), currentHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			if retired, err := cfg.DbQueries.GetRetiredOAuthRefreshToken(req.Context(), currentHash); err == nil {
+				cfg.revokeReplayedOAuthGrant(req, retired.GrantID, "refresh token")
+			}
+		}
+		if err != nil || grant.ClientID != client.ID || grant.RevokedAt.Valid || grant.RefreshExpiresAt.Before(now) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid refresh token")
+			return
+		}
+		refreshToken, err := auth.MakeRefreshToken()
+		if err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to generate refresh token")
+			return
+		}
+		// Rotation only succeeds for the current token, a concurrent refresh with the same one
+		// loses. The old token is kept so that presenting it again is recognised as a replay.
+		var rows int64
+		err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+			var err error
+			rows, err = q.RotateOAuthRefreshToken(req.Context(), database.RotateOAuthRefreshTokenParams{
+				NewRefreshTokenHash: auth.HashToken(refreshToken),
+				RefreshExpiresAt:    now.Add(refreshTokenTTL),
+				LastUsedAt:          now,
+				ID:                  grant.ID,
+				RefreshTokenHash:    grant.RefreshTokenHash,
+			})
+			if err != nil || rows == 0 {
+				return err
+			}
+			return q.RetireOAuthRefreshToken(req.Context(), database.RetireOAuthRefreshTokenParams{
+				TokenHash: grant.RefreshTokenHash,
+				GrantID:   grant.ID,
+				RetiredAt: now,
+			})
+		})
+		if err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to rotate refresh token")
+			return
+		}
+		if rows == 0 {
+			cfg.revokeReplayedOAuthGrant(req, grant.ID, "refresh token")
+			respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid refresh token")
+			return
+		}
+		cfg.respondWithOAuthTokens(w, grant, refreshToken)
+
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthUnsupportedGrantType, "Supported grant types are authorization_code and refresh_token")
+	}
+}
+
+func (cfg *Config) OAuthRevoke(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Invalid form")
+		return
+	}
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, "Client authentication failed")
+		return
+	}
+
+	// Revoking either token ends the whole grant. Unknown tokens are not an error (RFC 7009).
+	grant, _, err := cfg.activeOAuthGrant(req.Context(), client, req.PostFormValue("token"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to revoke token")
+		return
+	}
+	if err == nil {
+		if err := cfg.DbQueries.RevokeOAuthGrant(req.Context(), database.RevokeOAuthGrantParams{
+			ID:        grant.ID,
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}); err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to revoke token")
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *Config) OAuthIntrospect(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Invalid form")
+		return
+	}
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, "Client authentication failed")
+		return
+	}
+
+	// Response, RFC 7662. Clients can only introspect their own tokens.
+	type introspectionResponse struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Sub       string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+		Iat       int64  `json:"iat,omitempty"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	grant, claims, err := cfg.activeOAuthGrant(req.Context(), client, req.PostFormValue("token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithPayload(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to introspect token")
+		return
+	}
+
+	resp := introspectionResponse{
+		Active:   true,
+		Scope:    strings.Join(grant.Scopes, " "),
+		ClientID: grant.ClientID.String(),
+		Sub:      grant.UserID.String(),
+	}
+	if claims != nil {
+		resp.TokenType = "access_token"
+		resp.Exp = claims.ExpiresAt.Unix()
+		resp.Iat = claims.IssuedAt.Unix()
+	} else {
+		resp.TokenType = "refresh_token"
+		resp.Exp = grant.RefreshExpiresAt.Unix()
+		resp.Iat = grant.LastUsedAt.Unix()
+	}
+	respondWithPayload(w, http.StatusOK, resp)
+}
+
 // Auth Handlers
 
 func (cfg *Config) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -439,7 +2644,7 @@ func (cfg *Config) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshToken, err := cfg.DbQueries.GetRefreshToken(r.Context(), token)
+	refreshToken, err := cfg.DbQueries.GetRefreshToken(r.Context(), auth.HashToken(token))
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
@@ -448,22 +2653,53 @@ func (cfg *Config) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Refresh token expired")
 		return
 	}
-	if refreshToken.RevokedAt.Valid {
+
+	// A token that was already rotated out being used again means it leaked, end the whole login
+	reused := refreshToken.ReplacedBy.Valid
+	var newRefreshToken string
+	if !reused {
+		if refreshToken.RevokedAt.Valid {
+			respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
+			return
+		}
+		newRefreshToken, err = cfg.rotateRefreshToken(r.Context(), refreshToken, clientFromRequest(r))
+		reused = errors.Is(err, errRefreshTokenReused)
+		if err != nil && !reused {
+			respondWithError(w, http.StatusInternalServerError, "Failed to rotate refresh token")
+			return
+		}
+	}
+	if reused {
+		if err := cfg.revokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke refresh tokens")
+			return
+		}
+		cfg.logSecurityEvent(r.Context(), r, refreshToken.UserID, securityEventRefreshTokenReuse,
+			fmt.Sprintf("token family %s revoked", refreshToken.FamilyID))
 		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(refreshToken.UserID, cfg.BearerToken, 3600*time.Second)
+	// The role is read again so promotions and demotions apply from the next refresh
+	user, err := cfg.DbQueries.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate JWT")
+		return
+	}
+	accessToken, err := auth.MakeJWT(user.ID, cfg.JWTKeys, 3600*time.Second,
+		auth.WithSessionID(refreshToken.FamilyID), auth.WithRole(user.Role))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to generate JWT")
 		return
 	}
 
 	type userResponse struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	resp := userResponse{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	}
 	data, _ := json.Marshal(resp)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -484,7 +2720,7 @@ func (cfg *Config) RevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := cfg.DbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
-		Token: token,
+		TokenHash: auth.HashToken(token),
 		RevokedAt: sql.NullTime{
 			Time:  time.Now(),
 			Valid: true,
@@ -497,6 +2733,123 @@ func (cfg *Config) RevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusNoContent, "Refresh token revoked")
 }
 
+func (cfg *Config) ForgotPassword(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// The response never says whether the account exists, and mailing happens in the
+	// background so response times don't give it away either
+	if user, err := cfg.DbQueries.GetUserByEmail(req.Context(), params.Email); err == nil {
+		ctx := context.WithoutCancel(req.Context())
+		go func() {
+			if err := cfg.sendPasswordReset(ctx, user); err != nil {
+				log.Printf("Error sending password reset to user %s: %v", user.ID, err)
+			}
+		}()
+	}
+
+	respondWithPayload(w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for that email, a password reset link has been sent",
+	})
+}
+
+func (cfg *Config) ResetPassword(w http.ResponseWriter, req *http.Request) {
+	// Request
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil || params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	// Use the token, set the password and sign out every existing session together. The password
+	// is only checked and hashed once the token has been accepted, so guessing tokens costs no hashing.
+	now := time.Now()
+	var userID uuid.UUID
+	err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		reset, err := q.UsePasswordResetToken(req.Context(), database.UsePasswordResetTokenParams{
+			TokenHash: auth.HashToken(params.Token),
+			UsedAt:    sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		userID = reset.UserID
+		// Only now is it known whose password this is, a rejection rolls back so the token can be used again
+		user, err := q.GetUserByID(req.Context(), reset.UserID)
+		if err != nil {
+			return err
+		}
+		if err := cfg.checkPassword(params.Password, user.Email, user.Handle.String, user.DisplayName); err != nil {
+			return err
+		}
+		hashedPassword, err := auth.HashPassword(params.Password)
+		if err != nil {
+			return err
+		}
+		if err := q.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+			ID:             reset.UserID,
+			HashedPassword: hashedPassword,
+			UpdatedAt:      now,
+		}); err != nil {
+			return err
+		}
+		if err := q.RevokeUserRefreshTokens(req.Context(), database.RevokeUserRefreshTokensParams{
+			UserID:    reset.UserID,
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+		}); err != nil {
+			return err
+		}
+		// Tokens minted by whoever had the account must not outlive its recovery
+		if err := q.RevokeUserPersonalAccessTokens(req.Context(), database.RevokeUserPersonalAccessTokensParams{
+			UserID:    reset.UserID,
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+		}); err != nil {
+			return err
+		}
+		return q.RevokeUserOAuthGrants(req.Context(), database.RevokeUserOAuthGrantsParams{
+			UserID:    reset.UserID,
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+		})
+	})
+	if respondWithPasswordError(w, err, "password") {
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting password")
+		return
+	}
+
+	// Proving access to the mailbox lifts a lockout on the account
+	if user, err := cfg.DbQueries.GetUserByID(req.Context(), userID); err == nil {
+		cfg.clearAccountLockout(req.Context(), user.Email)
+	}
+
+	respondWithJSON(w, http.StatusNoContent, "Password reset")
+}
+
+func (cfg *Config) GetJWKS(w http.ResponseWriter, req *http.Request) {
+	// Only public keys are published, services can cache them briefly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithPayload(w, http.StatusOK, cfg.JWTKeys.JWKS())
+}
+
 // Webhook Handlers
 
 func (cfg *Config) ChirpyRedWebhook(w http.ResponseWriter, r *http.Request) {
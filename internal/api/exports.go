@@ -0,0 +1,340 @@
+package api
+
+import (
+	"archive/zip"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// userExport is everything Chirpy keeps about a user. Password, TOTP, recovery code and token
+// hashes are left out, they are credentials rather than data about the user.
+type userExport struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	Profile    exportProfile   `json:"profile"`
+	Chirps     []exportChirp   `json:"chirps"`
+	Sessions   []exportSession `json:"sessions"`
+	Account    exportAccount   `json:"account"`
+}
+
+type exportProfile struct {
+	ID               uuid.UUID  `json:"id"`
+	Email            string     `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	Handle           string     `json:"handle"`
+	DisplayName      string     `json:"display_name"`
+	Bio              string     `json:"bio"`
+	AvatarURL        string     `json:"avatar_url"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	Role             string     `json:"role"`
+	TwoFactorEnabled *time.Time `json:"two_factor_enabled_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeleteAfter      *time.Time `json:"delete_after"`
+}
+
+type exportChirp struct {
+	ID           uuid.UUID        `json:"id"`
+	Body         string           `json:"body"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	ParentID     uuid.NullUUID    `json:"parent_id"`
+	RootID       uuid.NullUUID    `json:"root_id"`
+	DeletedAt    *time.Time       `json:"deleted_at"`
+	LikeCount    int32            `json:"like_count"`
+	RechirpCount int32            `json:"rechirp_count"`
+	Revisions    []exportRevision `json:"revisions"`
+}
+
+type exportRevision struct {
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// exportSession is one login, with every address its refresh tokens were used from
+type exportSession struct {
+	ID          uuid.UUID  `json:"id"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddresses []string   `json:"ip_addresses"`
+	SignedInAt  time.Time  `json:"signed_in_at"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+}
+
+type exportAccount struct {
+	Following            []exportReference     `json:"following"`
+	Likes                []exportReference     `json:"likes"`
+	Rechirps             []exportReference     `json:"rechirps"`
+	PersonalAccessTokens []exportToken         `json:"personal_access_tokens"`
+	OAuthClients         []oauthClientResponse `json:"oauth_clients"`
+	OAuthGrants          []exportGrant         `json:"oauth_grants"`
+	LinkedIdentities     []exportIdentity      `json:"linked_identities"`
+	SecurityEvents       []exportSecurityEvent `json:"security_events"`
+}
+
+// exportReference is a user followed or a chirp liked or rechirped
+type exportReference struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportToken struct {
+	personalAccessTokenResponse
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type exportGrant struct {
+	ID         uuid.UUID  `json:"id"`
+	ClientID   uuid.UUID  `json:"client_id"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type exportIdentity struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type exportSecurityEvent struct {
+	Type      string    `json:"type"`
+	Details   string    `json:"details"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportUser gathers user's data in one transaction, so the parts agree with each other
+func (cfg *Config) exportUser(ctx context.Context, userID uuid.UUID) (userExport, error) {
+	var export userExport
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		user, err := q.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		chirps, err := q.GetUserChirps(ctx, userID)
+		if err != nil {
+			return err
+		}
+		revisions, err := q.GetUserChirpRevisions(ctx, userID)
+		if err != nil {
+			return err
+		}
+		refreshTokens, err := q.GetUserRefreshTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+		follows, err := q.GetUserFollows(ctx, userID)
+		if err != nil {
+			return err
+		}
+		likes, err := q.GetUserLikes(ctx, userID)
+		if err != nil {
+			return err
+		}
+		rechirps, err := q.GetUserRechirps(ctx, userID)
+		if err != nil {
+			return err
+		}
+		pats, err := q.GetAllUserPersonalAccessTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+		clients, err := q.GetUserOAuthClients(ctx, userID)
+		if err != nil {
+			return err
+		}
+		grants, err := q.GetUserOAuthGrants(ctx, userID)
+		if err != nil {
+			return err
+		}
+		identities, err := q.GetUserIdentities(ctx, userID)
+		if err != nil {
+			return err
+		}
+		events, err := q.GetUserSecurityEvents(ctx, uuid.NullUUID{UUID: userID, Valid: true})
+		if err != nil {
+			return err
+		}
+
+		export = userExport{
+			ExportedAt: time.Now(),
+			Profile: exportProfile{
+				ID:               user.ID,
+				Email:            user.Email,
+				EmailVerifiedAt:  timeOrNil(user.EmailVerifiedAt),
+				Handle:           user.Handle.String,
+				DisplayName:      user.DisplayName,
+				Bio:              user.Bio,
+				AvatarURL:        user.AvatarUrl,
+				IsChirpyRed:      user.IsChirpyRed,
+				Role:             user.Role,
+				TwoFactorEnabled: timeOrNil(user.TotpEnabledAt),
+				CreatedAt:        user.CreatedAt,
+				UpdatedAt:        user.UpdatedAt,
+				DeleteAfter:      timeOrNil(user.DeleteAfter),
+			},
+			Chirps:   exportChirps(chirps, revisions),
+			Sessions: exportSessions(refreshTokens),
+			Account: exportAccount{
+				Following:            make([]exportReference, 0, len(follows)),
+				Likes:                make([]exportReference, 0, len(likes)),
+				Rechirps:             make([]exportReference, 0, len(rechirps)),
+				PersonalAccessTokens: make([]exportToken, 0, len(pats)),
+				OAuthClients:         make([]oauthClientResponse, 0, len(clients)),
+				OAuthGrants:          make([]exportGrant, 0, len(grants)),
+				LinkedIdentities:     make([]exportIdentity, 0, len(identities)),
+				SecurityEvents:       make([]exportSecurityEvent, 0, len(events)),
+			},
+		}
+		account := &export.Account
+		for _, follow := range follows {
+			account.Following = append(account.Following, exportReference{ID: follow.FolloweeID, CreatedAt: follow.CreatedAt})
+		}
+		for _, like := range likes {
+			account.Likes = append(account.Likes, exportReference{ID: like.ChirpID, CreatedAt: like.CreatedAt})
+		}
+		for _, rechirp := range rechirps {
+			account.Rechirps = append(account.Rechirps, exportReference{ID: rechirp.ChirpID, CreatedAt: rechirp.CreatedAt})
+		}
+		for _, pat := range pats {
+			account.PersonalAccessTokens = append(account.PersonalAccessTokens, exportToken{
+				personalAccessTokenResponse: newPersonalAccessTokenResponse(pat),
+				RevokedAt:                   timeOrNil(pat.RevokedAt),
+			})
+		}
+		for _, client := range clients {
+			account.OAuthClients = append(account.OAuthClients, newOAuthClientResponse(client))
+		}
+		for _, grant := range grants {
+			account.OAuthGrants = append(account.OAuthGrants, exportGrant{
+				ID:         grant.ID,
+				ClientID:   grant.ClientID,
+				Scopes:     grant.Scopes,
+				CreatedAt:  grant.CreatedAt,
+				LastUsedAt: grant.LastUsedAt,
+				RevokedAt:  timeOrNil(grant.RevokedAt),
+			})
+		}
+		for _, identity := range identities {
+			account.LinkedIdentities = append(account.LinkedIdentities, exportIdentity{
+				Issuer:      identity.Issuer,
+				Subject:     identity.Subject,
+				Email:       identity.Email,
+				CreatedAt:   identity.CreatedAt,
+				LastLoginAt: identity.LastLoginAt,
+			})
+		}
+		for _, event := range events {
+			account.SecurityEvents = append(account.SecurityEvents, exportSecurityEvent{
+				Type:      event.EventType,
+				Details:   event.Details,
+				IPAddress: event.IpAddress,
+				CreatedAt: event.CreatedAt,
+			})
+		}
+		return nil
+	})
+	return export, err
+}
+
+func exportChirps(chirps []database.Chirp, revisions []database.ChirpRevision) []exportChirp {
+	byChirp := map[uuid.UUID][]exportRevision{}
+	for _, revision := range revisions {
+		byChirp[revision.ChirpID] = append(byChirp[revision.ChirpID], exportRevision{
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+	out := make([]exportChirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		out = append(out, exportChirp{
+			ID:           chirp.ID,
+			Body:         chirp.Body,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			ParentID:     chirp.ParentID,
+			RootID:       chirp.RootID,
+			DeletedAt:    timeOrNil(chirp.DeletedAt),
+			LikeCount:    chirp.LikeCount,
+			RechirpCount: chirp.RechirpCount,
+			Revisions:    append([]exportRevision{}, byChirp[chirp.ID]...),
+		})
+	}
+	return out
+}
+
+// exportSessions folds the refresh tokens of each login, which rotation leaves one per refresh,
+// into a single session. tokens must be ordered by creation.
+func exportSessions(tokens []database.RefreshToken) []exportSession {
+	out := []exportSession{}
+	index := map[uuid.UUID]int{}
+	for _, token := range tokens {
+		i, ok := index[token.FamilyID]
+		if !ok {
+			i = len(out)
+			index[token.FamilyID] = i
+			out = append(out, exportSession{
+				ID:          token.FamilyID,
+				IPAddresses: []string{},
+				SignedInAt:  token.CreatedAt,
+			})
+		}
+		session := &out[i]
+		// The newest token describes the session as it is now
+		session.UserAgent = token.UserAgent
+		session.ExpiresAt = token.ExpiresAt
+		session.EndedAt = timeOrNil(token.RevokedAt)
+		if token.LastUsedAt.After(session.LastUsedAt) {
+			session.LastUsedAt = token.LastUsedAt
+		}
+		if token.IpAddress != "" && !slices.Contains(session.IPAddresses, token.IpAddress) {
+			session.IPAddresses = append(session.IPAddresses, token.IpAddress)
+		}
+	}
+	return out
+}
+
+// writeExportZip writes export as an archive with one JSON file per part
+func writeExportZip(w io.Writer, export userExport) error {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"chirps.json", export.Chirps},
+		{"sessions.json", export.Sessions},
+		{"account.json", export.Account},
+	} {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(part.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
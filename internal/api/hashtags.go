@@ -0,0 +1,98 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxHashtagLength = 100
+
+// extractHashtags returns the normalized #tags in a chirp body, in order of first use.
+// A tag starts after a # that does not follow a word character and runs over letters,
+// marks, digits and underscores; it must contain at least one letter.
+func extractHashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isHashtagRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		hasLetter := false
+		for end < len(runes) && isHashtagRune(runes[end]) {
+			hasLetter = hasLetter || unicode.IsLetter(runes[end])
+			end++
+		}
+		if hasLetter && end-i-1 <= maxHashtagLength {
+			tag := normalizeHashtag(string(runes[i+1 : end]))
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		i = end - 1
+	}
+	return tags
+}
+
+func isHashtagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// normalizeHashtag maps every way of writing a tag, in any script, to the same key. NFKC first
+// makes composed and decomposed accents, full-width letters and the like agree, then the tag is
+// case-folded, and NFKC again recomposes anything folding took apart.
+func normalizeHashtag(tag string) string {
+	tag = norm.NFKC.String(strings.TrimPrefix(tag, "#"))
+	var b strings.Builder
+	for _, r := range tag {
+		b.WriteRune(foldRune(r))
+	}
+	return norm.NFKC.String(b.String())
+}
+
+// foldRune applies Unicode simple case folding, picking one lowercase member of each fold orbit
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < folded {
+			folded = f
+		}
+	}
+	return unicode.ToLower(folded)
+}
+
+// tagChirp replaces the hashtags recorded for a chirp with the ones in its current body
+func tagChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	if err := q.RemoveChirpHashtags(ctx, chirp.ID); err != nil {
+		return err
+	}
+	if chirp.DeletedAt.Valid {
+		return nil
+	}
+	for _, tag := range extractHashtags(chirp.Body) {
+		hashtag, err := q.UpsertHashtag(ctx, database.UpsertHashtagParams{
+			ID:        uuid.New(),
+			Tag:       tag,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.AddChirpHashtag(ctx, database.AddChirpHashtagParams{
+			ChirpID:   chirp.ID,
+			HashtagID: hashtag.ID,
+			CreatedAt: chirp.CreatedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
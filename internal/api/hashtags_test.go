@@ -0,0 +1,131 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "no tags",
+			body: "just a chirp",
+			want: nil,
+		},
+		{
+			name: "tags in order of first use",
+			body: "#Go is fun, #rust too, #go again",
+			want: []string{"go", "rust"},
+		},
+		{
+			name: "punctuation ends a tag",
+			body: "loving #chirpy! and (#golang)",
+			want: []string{"chirpy", "golang"},
+		},
+		{
+			name: "underscores and digits",
+			body: "#day_1 #100DaysOfCode",
+			want: []string{"day_1", "100daysofcode"},
+		},
+		{
+			name: "digits only is not a tag",
+			body: "issue #42",
+			want: nil,
+		},
+		{
+			name: "hash after a word character",
+			body: "C#sharp and a#b",
+			want: nil,
+		},
+		{
+			name: "doubled hash",
+			body: "##double",
+			want: []string{"double"},
+		},
+		{
+			name: "other scripts",
+			body: "#日本語 #Ünïcödé #ЁЖИК",
+			want: []string{"日本語", "ünïcödé", "ёжик"},
+		},
+		{
+			name: "different spellings of one tag",
+			body: "#Café #café #ＣＡＦÉ",
+			want: []string{"café"},
+		},
+		{
+			name: "too long",
+			body: "#" + strings.Repeat("a", maxHashtagLength+1) + " #" + strings.Repeat("b", maxHashtagLength),
+			want: []string{strings.Repeat("b", maxHashtagLength)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractHashtags(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("extractHashtags(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{
+			name: "ascii",
+			tag:  "GoLang",
+			want: "golang",
+		},
+		{
+			name: "leading hash",
+			tag:  "#Chirpy",
+			want: "chirpy",
+		},
+		{
+			name: "precomposed accent",
+			tag:  "Café",
+			want: "café",
+		},
+		{
+			name: "combining accent",
+			tag:  "Café",
+			want: "café",
+		},
+		{
+			name: "full-width letters",
+			tag:  "Ｇｏ",
+			want: "go",
+		},
+		{
+			name: "ligature",
+			tag:  "ﬁne",
+			want: "fine",
+		},
+		{
+			name: "greek final sigma",
+			tag:  "ΟΣ",
+			want: "οσ",
+		},
+		{
+			name: "kelvin sign",
+			tag:  "K",
+			want: "k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeHashtag(tt.tag); got != tt.want {
+				t.Errorf("normalizeHashtag(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -24,6 +26,29 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	}
 }
 
+// fieldError explains why one field of a request was rejected
+type fieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// respondWithFieldErrors responds like respondWithError, with the reasons for each rejected field
+// under "fields"
+func respondWithFieldErrors(w http.ResponseWriter, code int, message string, fields map[string][]fieldError) {
+	type errorResponse struct {
+		Error  string                  `json:"error"`
+		Fields map[string][]fieldError `json:"fields"`
+	}
+	log.Println(message)
+	resp := errorResponse{Error: message, Fields: fields}
+	data, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	type jsonResponse struct {
 		CleanedBody string `json:"cleaned_body"`
@@ -38,20 +63,173 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	}
 }
 
+func respondWithPayload(w http.ResponseWriter, code int, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+}
+
+type chirpResponse struct {
+	ID           uuid.UUID       `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Body         string          `json:"body"`
+	UserID       uuid.UUID       `json:"user_id"`
+	ParentID     uuid.NullUUID   `json:"parent_id"`
+	RootID       uuid.NullUUID   `json:"root_id"`
+	LikeCount    int32           `json:"like_count"`
+	RechirpCount int32           `json:"rechirp_count"`
+	LikedByMe    bool            `json:"liked_by_me"`
+	Mentions     []mentionEntity `json:"mentions"`
+}
+
+func newChirpResponse(chirp database.Chirp) chirpResponse {
+	return chirpResponse{
+		ID:           chirp.ID,
+		CreatedAt:    chirp.CreatedAt,
+		UpdatedAt:    chirp.UpdatedAt,
+		Body:         chirp.Body,
+		UserID:       chirp.UserID,
+		ParentID:     chirp.ParentID,
+		RootID:       chirp.RootID,
+		LikeCount:    chirp.LikeCount,
+		RechirpCount: chirp.RechirpCount,
+		Mentions:     []mentionEntity{},
+	}
+}
+
+// chirpResponses builds the responses for chirps as seen by the viewer, if any
+func (cfg *Config) chirpResponses(ctx context.Context, chirps []database.Chirp, viewerID uuid.NullUUID) ([]chirpResponse, error) {
+	resp := make([]chirpResponse, 0, len(chirps))
+	index := make(map[uuid.UUID]int, len(chirps))
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for i, chirp := range chirps {
+		resp = append(resp, newChirpResponse(chirp))
+		index[chirp.ID] = i
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirps) == 0 {
+		return resp, nil
+	}
+
+	// Attach resolved mentions
+	mentions, err := cfg.DbQueries.GetChirpMentions(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mentions {
+		i := index[m.ChirpID]
+		resp[i].Mentions = append(resp[i].Mentions, mentionEntity{
+			UserID: m.UserID,
+			Handle: m.Handle.String,
+			Start:  m.StartOffset,
+			End:    m.EndOffset,
+		})
+	}
+	if !viewerID.Valid {
+		return resp, nil
+	}
+
+	// Mark the chirps the viewer has liked
+	likedIDs, err := cfg.DbQueries.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   viewerID.UUID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	liked := make(map[uuid.UUID]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	for i := range resp {
+		resp[i].LikedByMe = liked[resp[i].ID]
+	}
+	return resp, nil
+}
+
+// pageChirps trims the extra row callers fetch past the page size and returns the cursor for the following page
+func pageChirps(chirps []database.Chirp, pageSize int32) ([]database.Chirp, *string) {
+	if len(chirps) <= int(pageSize) {
+		return chirps, nil
+	}
+	chirps = chirps[:pageSize]
+	last := chirps[len(chirps)-1]
+	cursor := encodeCursor(last.CreatedAt, last.ID)
+	return chirps, &cursor
+}
+
+func respondWithChirpsPage(w http.ResponseWriter, code int, chirps []chirpResponse, nextCursor *string) {
+	type pageResponse struct {
+		Chirps     []chirpResponse `json:"chirps"`
+		NextCursor *string         `json:"next_cursor"`
+	}
+	respondWithPayload(w, code, pageResponse{Chirps: chirps, NextCursor: nextCursor})
+}
+
+// indexChirp records the hashtags and mentions found in a chirp's current body
+func indexChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	if err := tagChirp(ctx, q, chirp); err != nil {
+		return err
+	}
+	return mentionChirp(ctx, q, chirp)
+}
+
+// withTx runs fn inside a database transaction, rolling back if it returns an error
+func (cfg *Config) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg.DbQueries.WithTx(tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// viewerFromRequest returns the user OptionalAuth found for the request, if any
+func viewerFromRequest(req *http.Request) uuid.NullUUID {
+	p, ok := PrincipalFromContext(req.Context())
+	if !ok {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.UserID, Valid: true}
+}
+
 func respondWithUserJSON(w http.ResponseWriter, code int, user database.User) {
 	type userResponse struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID  `json:"id"`
+		CreatedAt     time.Time  `json:"created_at"`
+		UpdatedAt     time.Time  `json:"updated_at"`
+		Email         string     `json:"email"`
+		IsChirpyRed   bool       `json:"is_chirpy_red"`
+		Handle        string     `json:"handle"`
+		DisplayName   string     `json:"display_name"`
+		Bio           string     `json:"bio"`
+		AvatarURL     string     `json:"avatar_url"`
+		EmailVerified bool       `json:"email_verified"`
+		TwoFactor     bool       `json:"two_factor_enabled"`
+		Role          string     `json:"role"`
+		DeleteAfter   *time.Time `json:"delete_after,omitempty"`
 	}
 	resp := userResponse{
-		ID:          user.ID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        user.Handle.String,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarUrl,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		TwoFactor:     user.TotpEnabledAt.Valid,
+		Role:          user.Role,
+		DeleteAfter:   timeOrNil(user.DeleteAfter),
 	}
 	data, _ := json.Marshal(resp)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -60,3 +238,54 @@ func respondWithUserJSON(w http.ResponseWriter, code int, user database.User) {
 		return
 	}
 }
+
+// respondWithLogin issues an access token and refresh token for a user who has fully authenticated
+func (cfg *Config) respondWithLogin(w http.ResponseWriter, req *http.Request, user database.User) {
+	// Each login starts a session, the refresh token family every rotation stays in
+	sessionID := uuid.New()
+
+	// Generate JWT accessToken, expires in 1 hour
+	accessToken, err := auth.MakeJWT(user.ID, cfg.JWTKeys, 3600*time.Second, auth.WithSessionID(sessionID), auth.WithRole(user.Role))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate JWT")
+		return
+	}
+
+	// Generate refreshToken, expires in 60 days
+	refreshToken, err := issueRefreshToken(req.Context(), cfg.DbQueries, user.ID, sessionID, time.Now().Add(refreshTokenTTL), clientFromRequest(req))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate refresh token")
+		return
+	}
+
+	// Response
+	type userResponse struct {
+		ID           uuid.UUID `json:"id"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		IsChirpyRed  bool      `json:"is_chirpy_red"`
+		Role         string    `json:"role"`
+		Token        string    `json:"token"`
+		RefreshToken string    `json:"refresh_token"`
+		// DeleteAfter tells a user who signs back in that their account is about to be deleted
+		DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	}
+	resp := userResponse{
+		ID:           user.ID,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Email:        user.Email,
+		IsChirpyRed:  user.IsChirpyRed,
+		Role:         user.Role,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		DeleteAfter:  timeOrNil(user.DeleteAfter),
+	}
+	data, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed logins are limited per account, so one account can't be guessed from many addresses,
+// and per client IP, so one address can't guess across many accounts
+const (
+	accountLockoutPrefix = "account:"
+	ipLockoutPrefix      = "ip:"
+)
+
+func accountLockoutKey(email string) string {
+	return accountLockoutPrefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+// reserveLoginAttempt counts an attempt to log in as email from ip against both the account and
+// the client before the credentials are checked, so parallel guesses can't all start before the
+// first is counted. When either has to wait it counts nothing and returns the wait. A wrong
+// attempt needs nothing more, it stays counted as a failure.
+func (cfg *Config) reserveLoginAttempt(ctx context.Context, email, ip string) (time.Duration, error) {
+	ipWait, err := cfg.IPLimiter.Attempt(ctx, ipLockoutPrefix+ip)
+	if err != nil || ipWait > 0 {
+		return ipWait, err
+	}
+	accountWait, err := cfg.AccountLimiter.Attempt(ctx, accountLockoutKey(email))
+	if err != nil || accountWait > 0 {
+		if err := cfg.IPLimiter.Succeed(ctx, ipLockoutPrefix+ip); err != nil {
+			log.Printf("Error releasing login attempt from %s: %v", ip, err)
+		}
+		return accountWait, err
+	}
+	return 0, nil
+}
+
+// releaseLoginAttempt takes back an attempt whose password was right, while a second factor
+// is still to come
+func (cfg *Config) releaseLoginAttempt(ctx context.Context, email, ip string) {
+	if err := cfg.AccountLimiter.Succeed(ctx, accountLockoutKey(email)); err != nil {
+		log.Printf("Error releasing login attempt for %s: %v", email, err)
+	}
+	if err := cfg.IPLimiter.Succeed(ctx, ipLockoutPrefix+ip); err != nil {
+		log.Printf("Error releasing login attempt from %s: %v", ip, err)
+	}
+}
+
+// recordLoginSuccess clears the account's failures and takes back the client's attempt. The IP
+// keeps its earlier failures, otherwise logging in to one account the client owns would reset its
+// guesses against every other account.
+func (cfg *Config) recordLoginSuccess(ctx context.Context, email, ip string) {
+	cfg.clearAccountLockout(ctx, email)
+	if err := cfg.IPLimiter.Succeed(ctx, ipLockoutPrefix+ip); err != nil {
+		log.Printf("Error releasing login attempt from %s: %v", ip, err)
+	}
+}
+
+// clearAccountLockout forgets the account's failures
+func (cfg *Config) clearAccountLockout(ctx context.Context, email string) {
+	if err := cfg.AccountLimiter.Reset(ctx, accountLockoutKey(email)); err != nil {
+		log.Printf("Error clearing failed logins for %s: %v", email, err)
+	}
+}
+
+// setRetryAfter tells the client how many whole seconds to wait
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+func respondWithTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	setRetryAfter(w, wait)
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
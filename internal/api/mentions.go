@@ -0,0 +1,95 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const maxHandleLength = 30
+
+type mention struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+type mentionEntity struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+	Start  int32     `json:"start"`
+	End    int32     `json:"end"`
+}
+
+// extractMentions returns the @handle mentions in a chirp body. Start and End are
+// rune offsets into the body covering the @ and the handle. An @ that follows a word
+// character, such as in an email address, is not a mention.
+func extractMentions(body string) []mention {
+	var mentions []mention
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && (isHandleRune(runes[i-1]) || runes[i-1] == '@')) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isHandleRune(runes[end]) {
+			end++
+		}
+		if length := end - i - 1; length > 0 && length <= maxHandleLength {
+			mentions = append(mentions, mention{Handle: string(runes[i+1 : end]), Start: i, End: end})
+		}
+		i = end - 1
+	}
+	return mentions
+}
+
+func isHandleRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// mentionChirp replaces the mentions recorded for a chirp with the ones in its current body.
+// Handles that do not belong to a user are left as plain text.
+func mentionChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	if err := q.RemoveChirpMentions(ctx, chirp.ID); err != nil {
+		return err
+	}
+	mentions := extractMentions(chirp.Body)
+	if chirp.DeletedAt.Valid || len(mentions) == 0 {
+		return nil
+	}
+
+	// Resolve handles case-insensitively
+	handles := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		handles = append(handles, strings.ToLower(m.Handle))
+	}
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Handle.String)] = user.ID
+	}
+
+	for _, m := range mentions {
+		userID, ok := userIDs[strings.ToLower(m.Handle)]
+		if !ok {
+			continue
+		}
+		if err := q.AddChirpMention(ctx, database.AddChirpMentionParams{
+			ChirpID:     chirp.ID,
+			UserID:      userID,
+			StartOffset: int32(m.Start),
+			EndOffset:   int32(m.End),
+			CreatedAt:   time.Now(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
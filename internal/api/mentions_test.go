@@ -0,0 +1,73 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []mention
+	}{
+		{
+			name: "no mentions",
+			body: "hello world",
+			want: nil,
+		},
+		{
+			name: "one mention",
+			body: "hi @alice!",
+			want: []mention{{Handle: "alice", Start: 3, End: 9}},
+		},
+		{
+			name: "repeats are kept with their own offsets",
+			body: "@bob and @Bob_2 and @bob",
+			want: []mention{
+				{Handle: "bob", Start: 0, End: 4},
+				{Handle: "Bob_2", Start: 9, End: 15},
+				{Handle: "bob", Start: 20, End: 24},
+			},
+		},
+		{
+			name: "offsets count runes",
+			body: "héllo 👋 @carol",
+			want: []mention{{Handle: "carol", Start: 8, End: 14}},
+		},
+		{
+			name: "email address",
+			body: "mail me at dave@example.com",
+			want: nil,
+		},
+		{
+			name: "doubled at",
+			body: "@@erin",
+			want: nil,
+		},
+		{
+			name: "bare at",
+			body: "meet @ noon",
+			want: nil,
+		},
+		{
+			name: "longest handle",
+			body: "@" + strings.Repeat("a", maxHandleLength),
+			want: []mention{{Handle: strings.Repeat("a", maxHandleLength), Start: 0, End: maxHandleLength + 1}},
+		},
+		{
+			name: "too long",
+			body: "@" + strings.Repeat("a", maxHandleLength+1),
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractMentions(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
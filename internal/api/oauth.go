@@ -0,0 +1,412 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeTTL        = 5 * time.Minute
+	oauthAccessTokenTTL = time.Hour
+	maxRedirectURIs     = 10
+)
+
+// Error codes from RFC 6749 section 4.1.2.1 and 5.2
+const (
+	oauthInvalidRequest          = "invalid_request"
+	oauthInvalidClient           = "invalid_client"
+	oauthInvalidGrant            = "invalid_grant"
+	oauthInvalidScope            = "invalid_scope"
+	oauthAccessDenied            = "access_denied"
+	oauthUnsupportedGrantType    = "unsupported_grant_type"
+	oauthUnsupportedResponseType = "unsupported_response_type"
+	oauthServerError             = "server_error"
+)
+
+var errInvalidClient = errors.New("invalid client credentials")
+
+// scopeDescriptions are shown on the consent page
+var scopeDescriptions = map[string]string{
+	ScopeChirpsRead:   "See your timeline",
+	ScopeChirpsWrite:  "Post, edit and delete chirps, and like and rechirp for you",
+	ScopeProfileWrite: "Change your public profile",
+	ScopeFollowsWrite: "Follow and unfollow users for you",
+}
+
+// validateRedirectURI accepts absolute URLs without a fragment. Plain http is only allowed for
+// loopback addresses, where native apps listen for the redirect.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" && (u.Scheme == "http" || u.Scheme == "https") {
+		return fmt.Errorf("redirect URI %q must be an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not have a fragment", raw)
+	}
+	if u.Scheme == "http" && u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" && u.Hostname() != "::1" {
+		return fmt.Errorf("redirect URI %q must use https", raw)
+	}
+	if u.Scheme == "javascript" || u.Scheme == "data" {
+		return fmt.Errorf("redirect URI %q uses a forbidden scheme", raw)
+	}
+	return nil
+}
+
+// parseOAuthScopes reads a space separated scope parameter, only the scopes a personal access
+// token could hold can be granted to a client
+func parseOAuthScopes(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(grantableScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// respondWithOAuthError writes the JSON error body the token, revocation and introspection
+// endpoints use
+func respondWithOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	type oauthErrorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithPayload(w, code, oauthErrorResponse{Error: errCode, ErrorDescription: description})
+}
+
+// authenticateClient identifies the client calling a back channel endpoint, from HTTP Basic
+// credentials or the client_id and client_secret form fields. Public clients only send their ID.
+func (cfg *Config) authenticateClient(req *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := req.BasicAuth()
+	if ok {
+		// Basic credentials are form encoded before they are joined, RFC 6749 section 2.3.1
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		clientID = req.PostFormValue("client_id")
+		secret = req.PostFormValue("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+	client, err := cfg.DbQueries.GetOAuthClient(req.Context(), id)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errInvalidClient
+	}
+	return client, nil
+}
+
+// authorizeRequest holds the parameters of an authorization request, carried through the
+// consent form as hidden fields
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func newAuthorizeRequest(values url.Values) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// authorizeError is a failed authorization request. Errors found before the client and
+// redirect URI are trusted are shown to the user, the rest are sent back to the client.
+type authorizeError struct {
+	code        string
+	description string
+	redirect    bool
+}
+
+// validateAuthorizeRequest checks the request against the registered client and returns the
+// client, the redirect URI to answer on and the requested scopes
+func (cfg *Config) validateAuthorizeRequest(ctx context.Context, ar authorizeRequest) (database.OauthClient, string, []string, *authorizeError) {
+	id, err := uuid.Parse(ar.ClientID)
+	if err != nil {
+		return database.OauthClient{}, "", nil, &authorizeError{code: oauthInvalidRequest, description: "Unknown client"}
+	}
+	client, err := cfg.DbQueries.GetOAuthClient(ctx, id)
+	if err != nil {
+		return database.OauthClient{}, "", nil, &authorizeError{code: oauthInvalidRequest, description: "Unknown client"}
+	}
+
+	// Redirect URIs must be sent and match a registered one exactly
+	redirectURI := ar.RedirectURI
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return client, "", nil, &authorizeError{code: oauthInvalidRequest, description: "Redirect URI is not registered for this client"}
+	}
+
+	if ar.ResponseType != "code" {
+		return client, redirectURI, nil, &authorizeError{code: oauthUnsupportedResponseType, description: "Only the code response type is supported", redirect: true}
+	}
+	if ar.CodeChallengeMethod != auth.PKCEMethodS256 || len(ar.CodeChallenge) != 43 {
+		return client, redirectURI, nil, &authorizeError{code: oauthInvalidRequest, description: "PKCE with an S256 code challenge is required", redirect: true}
+	}
+	scopes, err := parseOAuthScopes(ar.Scope)
+	if err != nil {
+		return client, redirectURI, nil, &authorizeError{code: oauthInvalidScope, description: err.Error(), redirect: true}
+	}
+	return client, redirectURI, scopes, nil
+}
+
+// redirectToClient sends the user agent back to the client with params added to redirectURI
+func redirectToClient(w http.ResponseWriter, req *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Invalid redirect URI")
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, req, u.String(), http.StatusFound)
+}
+
+// redirectWithAuthorizeError reports err to the client, keeping the state it sent
+func redirectWithAuthorizeError(w http.ResponseWriter, req *http.Request, redirectURI, state string, err *authorizeError) {
+	params := url.Values{"error": {err.code}, "error_description": {err.description}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	redirectToClient(w, req, redirectURI, params)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.ClientName}} - Chirpy</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+label { display: block; margin-top: 0.75rem; }
+input[type=email], input[type=password], input[type=text] { width: 100%; padding: 0.4rem; box-sizing: border-box; }
+.error { color: #b00020; }
+.actions { margin-top: 1.25rem; display: flex; gap: 0.5rem; }
+</style>
+</head>
+<body>
+{{if .ClientName}}
+<h1>Authorize {{.ClientName}}</h1>
+<p><strong>{{.ClientName}}</strong> wants to use your Chirpy account to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<p>It will never see your password.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label>
+<label>Password <input type="password" name="password" autocomplete="current-password"></label>
+<label>Authentication or recovery code, if two-factor authentication is on <input type="text" name="code" autocomplete="one-time-code"></label>
+<div class="actions">
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</div>
+</form>
+{{else}}
+<h1>Authorization failed</h1>
+<p class="error">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+type consentPage struct {
+	ClientName string
+	Scopes     []string
+	Request    authorizeRequest
+	Email      string
+	Error      string
+}
+
+// renderConsentPage shows the consent form, or just the error when ClientName is empty
+func renderConsentPage(w http.ResponseWriter, code int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The page takes a password, it must not be framed by another site
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering consent page: %v", err)
+	}
+}
+
+func describeScopes(scopes []string) []string {
+	descriptions := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		descriptions = append(descriptions, scopeDescriptions[scope])
+	}
+	return descriptions
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// respondWithOAuthTokens issues an access token for grant along with refreshToken
+func (cfg *Config) respondWithOAuthTokens(w http.ResponseWriter, grant database.OauthGrant, refreshToken string) {
+	accessToken, err := auth.MakeJWT(grant.UserID, cfg.JWTKeys, oauthAccessTokenTTL,
+		auth.WithSessionID(grant.ID), auth.WithClient(grant.ClientID.String(), grant.Scopes))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthServerError, "Failed to generate access token")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithPayload(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// activeOAuthGrant returns the grant behind an access or refresh token issued to client. Tokens
+// of other clients, expired tokens and revoked grants are reported as sql.ErrNoRows.
+func (cfg *Config) activeOAuthGrant(ctx context.Context, client database.OauthClient, token string) (database.OauthGrant, *auth.AccessClaims, error) {
+	var grant database.OauthGrant
+	claims, err := auth.ParseJWT(token, cfg.JWTKeys)
+	if err == nil {
+		if claims.ClientID != client.ID.String() || !claims.Session().Valid {
+			return database.OauthGrant{}, nil, sql.ErrNoRows
+		}
+		grant, err = cfg.DbQueries.GetOAuthGrant(ctx, claims.Session().UUID)
+	} else {
+		grant, err = cfg.DbQueries.GetOAuthGrantByRefreshToken(ctx, auth.HashToken(token))
+		if err == nil && grant.RefreshExpiresAt.Before(time.Now()) {
+			return database.OauthGrant{}, nil, sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		return database.OauthGrant{}, nil, err
+	}
+	if grant.ClientID != client.ID || grant.RevokedAt.Valid {
+		return database.OauthGrant{}, nil, sql.ErrNoRows
+	}
+	return grant, claims, nil
+}
+
+// revokeReplayedOAuthGrant ends a grant one of whose codes or refresh tokens was presented again
+// after being used. Either the client or an attacker holds a copy, and there is no telling which
+// (RFC 6749 section 4.1.2 and 10.4). Failures are only logged, the replay is refused either way.
+func (cfg *Config) revokeReplayedOAuthGrant(req *http.Request, grantID uuid.UUID, what string) {
+	ctx := req.Context()
+	grant, err := cfg.DbQueries.GetOAuthGrant(ctx, grantID)
+	if err != nil {
+		log.Printf("Error looking up replayed OAuth grant %s: %v", grantID, err)
+		return
+	}
+	if grant.RevokedAt.Valid {
+		return
+	}
+	if err := cfg.DbQueries.RevokeOAuthGrant(ctx, database.RevokeOAuthGrantParams{
+		ID:        grant.ID,
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}); err != nil {
+		log.Printf("Error revoking replayed OAuth grant %s: %v", grant.ID, err)
+		return
+	}
+	cfg.logSecurityEvent(ctx, req, grant.UserID, securityEventOAuthReplay, fmt.Sprintf("%s replayed, OAuth grant %s revoked", what, grant.ID))
+}
+
+type oauthClientResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ClientSecret is only returned when a confidential client is registered
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientResponse(client database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validateClientRequest checks the name and redirect URIs a client is registered with
+func validateClientRequest(name string, redirectURIs []string) error {
+	if name == "" || len(name) > maxTokenNameLength {
+		return fmt.Errorf("name must be between 1 and %d characters", maxTokenNameLength)
+	}
+	if len(redirectURIs) == 0 || len(redirectURIs) > maxRedirectURIs {
+		return fmt.Errorf("between 1 and %d redirect URIs are required", maxRedirectURIs)
+	}
+	for _, uri := range redirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/oidc"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// oidcStateTTL is how long a user has to finish signing in at the provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie ties the callback to the browser that started the login, so nobody can be
+	// signed in to an account an attacker started a login for
+	oidcStateCookie = "chirpy_oidc_state"
+)
+
+var (
+	errOIDCNoEmail          = errors.New("the provider did not share a usable email address")
+	errOIDCEmailNotLinkable = errors.New("an account with this email exists, sign in with its password first")
+)
+
+// startOIDCLogin stores a pending login and returns the state to send to the provider and put in the cookie
+func (cfg *Config) startOIDCLogin(ctx context.Context) (state, nonce, verifier string, err error) {
+	if state, err = auth.MakeRefreshToken(); err != nil {
+		return "", "", "", err
+	}
+	if nonce, err = auth.MakeRefreshToken(); err != nil {
+		return "", "", "", err
+	}
+	if verifier, err = oidc.NewVerifier(); err != nil {
+		return "", "", "", err
+	}
+
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		// Abandoned logins are cleared out as new ones start
+		if err := q.DeleteExpiredOIDCLoginStates(ctx, time.Now()); err != nil {
+			return err
+		}
+		return q.CreateOIDCLoginState(ctx, database.CreateOIDCLoginStateParams{
+			StateHash:    auth.HashToken(state),
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			CreatedAt:    time.Now(),
+			ExpiresAt:    time.Now().Add(oidcStateTTL),
+		})
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+	return state, nonce, verifier, nil
+}
+
+// consumeOIDCLogin returns the pending login for state, which can only be used once
+func (cfg *Config) consumeOIDCLogin(ctx context.Context, state string) (database.OidcLoginState, error) {
+	login, err := cfg.DbQueries.ConsumeOIDCLoginState(ctx, auth.HashToken(state))
+	if err != nil {
+		return database.OidcLoginState{}, err
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return database.OidcLoginState{}, sql.ErrNoRows
+	}
+	return login, nil
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, req *http.Request, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/login/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		// Lax, because the provider sends the user back with a top level navigation
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// userForIdentity returns the user a provider account signs in as. A first login links to the
+// account with the same email when both the provider and Chirpy have verified the address, and
+// creates a new account when there is none.
+func (cfg *Config) userForIdentity(ctx context.Context, req *http.Request, idToken *oidc.IDToken) (database.User, error) {
+	var user database.User
+	linked, created := false, false
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		identity, err := q.GetUserIdentity(ctx, database.GetUserIdentityParams{
+			Issuer:  idToken.Issuer,
+			Subject: idToken.Subject,
+		})
+		if err == nil {
+			if err := q.UpdateUserIdentityLogin(ctx, database.UpdateUserIdentityLoginParams{
+				ID:          identity.ID,
+				Email:       idToken.Email,
+				LastLoginAt: time.Now(),
+			}); err != nil {
+				return err
+			}
+			user, err = q.GetUserByID(ctx, identity.UserID)
+			return err
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if validateEmail(idToken.Email) != nil {
+			return errOIDCNoEmail
+		}
+		user, err = q.GetUserByEmail(ctx, idToken.Email)
+		switch {
+		case err == nil:
+			// Linking on an unverified address would let whoever registered it first take over
+			// the provider account's logins, or the other way round
+			if !idToken.EmailVerified || !user.EmailVerifiedAt.Valid {
+				return errOIDCEmailNotLinkable
+			}
+			linked = true
+		case errors.Is(err, sql.ErrNoRows):
+			if user, err = createOIDCUser(ctx, q, idToken); err != nil {
+				return err
+			}
+			created = true
+		default:
+			return err
+		}
+
+		_, err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			ID:          uuid.New(),
+			UserID:      user.ID,
+			Issuer:      idToken.Issuer,
+			Subject:     idToken.Subject,
+			Email:       idToken.Email,
+			CreatedAt:   time.Now(),
+			LastLoginAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if linked {
+		cfg.logSecurityEvent(ctx, req, user.ID, securityEventIdentityLinked, fmt.Sprintf("issuer=%s", idToken.Issuer))
+	}
+	// An address the provider hasn't verified is checked the same way as on registration
+	if created && !user.EmailVerifiedAt.Valid {
+		if err := cfg.sendEmailVerification(ctx, user); err != nil {
+			log.Printf("Error sending email verification to user %s: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// createOIDCUser creates the account for a new provider login. Its password is random and never
+// shown, the user can choose one with a password reset.
+func createOIDCUser(ctx context.Context, q *database.Queries, idToken *oidc.IDToken) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	displayName := idToken.Name
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		displayName = string([]rune(displayName)[:maxDisplayNameLength])
+	}
+	user, err := q.CreateUser(ctx, database.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Email:          idToken.Email,
+		HashedPassword: hashedPassword,
+		DisplayName:    displayName,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if idToken.EmailVerified {
+		if err := q.SetUserEmailVerified(ctx, database.SetUserEmailVerifiedParams{
+			ID:              user.ID,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}); err != nil {
+			return database.User{}, err
+		}
+		return q.GetUserByID(ctx, user.ID)
+	}
+	return user, nil
+}
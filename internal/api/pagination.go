@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// Sentinel keys used when no cursor is supplied, so the first page can share
+// the same keyset query as every following page.
+var (
+	minCursorTime = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxCursorTime = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+	maxCursorID   = uuid.Must(uuid.Parse("ffffffff-ffff-ffff-ffff-ffffffffffff"))
+)
+
+// encodeCursor builds an opaque pagination cursor from a row's sort key
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the sort key stored in a cursor built by encodeCursor
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	createdAtPart, idPart, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	return createdAt, id, nil
+}
+
+// encodeRankCursor builds an opaque pagination cursor for results ordered by relevance
+func encodeRankCursor(rank float32, id uuid.UUID) string {
+	raw := strconv.FormatFloat(float64(rank), 'g', -1, 32) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseRankCursor reads a cursor built by encodeRankCursor, defaulting to the most relevant result
+func parseRankCursor(query url.Values) (float32, uuid.UUID, error) {
+	cursor := query.Get("cursor")
+	if cursor == "" {
+		return math.MaxFloat32, maxCursorID, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+	rankPart, idPart, found := strings.Cut(string(raw), "|")
+	if !found {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+	rank, err := strconv.ParseFloat(rankPart, 32)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+	return float32(rank), id, nil
+}
+
+// parseCursor reads the cursor query parameter, defaulting to the first row in sort order
+func parseCursor(query url.Values, descending bool) (time.Time, uuid.UUID, error) {
+	if cursor := query.Get("cursor"); cursor != "" {
+		return decodeCursor(cursor)
+	}
+	if descending {
+		return maxCursorTime, maxCursorID, nil
+	}
+	return minCursorTime, uuid.Nil, nil
+}
+
+// parsePageSize reads the limit query parameter, applying the default and maximum page size
+func parsePageSize(query url.Values) (int32, error) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return defaultPageSize, nil
+	}
+	size, err := strconv.Atoi(limit)
+	if err != nil || size < 1 {
+		return 0, errors.New("invalid limit")
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return int32(size), nil
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/base64"
+	"math"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		id        uuid.UUID
+	}{
+		{
+			name:      "nanosecond precision",
+			createdAt: time.Date(2024, time.March, 9, 14, 30, 15, 123456789, time.UTC),
+			id:        uuid.New(),
+		},
+		{
+			name:      "other time zone",
+			createdAt: time.Date(2023, time.December, 31, 23, 59, 59, 0, time.FixedZone("UTC+9", 9*60*60)),
+			id:        uuid.New(),
+		},
+		{
+			name:      "sentinels",
+			createdAt: maxCursorTime,
+			id:        maxCursorID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt, id, err := decodeCursor(encodeCursor(tt.createdAt, tt.id))
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if !createdAt.Equal(tt.createdAt) {
+				t.Errorf("decodeCursor() createdAt = %v, want %v", createdAt, tt.createdAt)
+			}
+			if id != tt.id {
+				t.Errorf("decodeCursor() id = %v, want %v", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "no separator", cursor: encode("2024-03-09T14:30:15Z")},
+		{name: "bad time", cursor: encode("yesterday|" + uuid.NewString())},
+		{name: "bad id", cursor: encode("2024-03-09T14:30:15Z|not-a-uuid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q) error = nil, want an error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestRankCursor_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rank float32
+	}{
+		{name: "typical rank", rank: 0.0607927},
+		{name: "zero", rank: 0},
+		{name: "smallest float", rank: math.SmallestNonzeroFloat32},
+		{name: "largest float", rank: math.MaxFloat32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := uuid.New()
+			query := url.Values{"cursor": {encodeRankCursor(tt.rank, want)}}
+			rank, id, err := parseRankCursor(query)
+			if err != nil {
+				t.Fatalf("parseRankCursor() error = %v", err)
+			}
+			if rank != tt.rank {
+				t.Errorf("parseRankCursor() rank = %v, want %v", rank, tt.rank)
+			}
+			if id != want {
+				t.Errorf("parseRankCursor() id = %v, want %v", id, want)
+			}
+		})
+	}
+
+	if _, _, err := parseRankCursor(url.Values{"cursor": {encodeCursor(time.Now(), uuid.New())}}); err == nil {
+		t.Error("parseRankCursor() accepted a time cursor")
+	}
+}
+
+func TestParseCursor_Defaults(t *testing.T) {
+	createdAt, id, err := parseCursor(url.Values{}, true)
+	if err != nil || !createdAt.Equal(maxCursorTime) || id != maxCursorID {
+		t.Errorf("parseCursor(descending) = %v, %v, %v, want the largest key", createdAt, id, err)
+	}
+	createdAt, id, err = parseCursor(url.Values{}, false)
+	if err != nil || !createdAt.Equal(minCursorTime) || id != uuid.Nil {
+		t.Errorf("parseCursor(ascending) = %v, %v, %v, want the smallest key", createdAt, id, err)
+	}
+	rank, id, err := parseRankCursor(url.Values{})
+	if err != nil || rank != math.MaxFloat32 || id != maxCursorID {
+		t.Errorf("parseRankCursor() = %v, %v, %v, want the largest key", rank, id, err)
+	}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   string
+		want    int32
+		wantErr bool
+	}{
+		{name: "default", limit: "", want: defaultPageSize},
+		{name: "explicit", limit: "10", want: 10},
+		{name: "capped", limit: "1000", want: maxPageSize},
+		{name: "zero", limit: "0", wantErr: true},
+		{name: "negative", limit: "-5", wantErr: true},
+		{name: "not a number", limit: "ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{}
+			if tt.limit != "" {
+				query.Set("limit", tt.limit)
+			}
+			got, err := parsePageSize(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePageSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
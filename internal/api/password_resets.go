@@ -0,0 +1,65 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	passwordResetTokenTTL = time.Hour
+	// passwordResetCooldown is how long after one reset email no other is sent for the account,
+	// unless the first has been used
+	passwordResetCooldown = 5 * time.Minute
+)
+
+// sendPasswordReset stores a single-use reset token for user and mails it, replacing any
+// reset that was requested earlier and not used. Nothing is sent while an unused reset from the
+// last passwordResetCooldown is pending, so the endpoint can't be used to flood a mailbox.
+func (cfg *Config) sendPasswordReset(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	throttled := false
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		// The row lock makes concurrent requests for the account take turns, so only one sends
+		if _, err := q.LockUser(ctx, user.ID); err != nil {
+			return err
+		}
+		recent, err := q.CountRecentPasswordResetTokens(ctx, database.CountRecentPasswordResetTokensParams{
+			UserID: user.ID,
+			Since:  time.Now().Add(-passwordResetCooldown),
+		})
+		if err != nil {
+			return err
+		}
+		if recent > 0 {
+			throttled = true
+			return nil
+		}
+		if err := q.DeletePendingPasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		_, err = q.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+		})
+		return err
+	})
+	if err != nil || throttled {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Choose a new password by sending the token below with it to POST /api/password/reset.\n\n%s\n\nThe token expires in 1 hour. If you did not ask to reset your password you can ignore this email.\n",
+			token),
+	})
+}
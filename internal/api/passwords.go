@@ -0,0 +1,71 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/passwordpolicy"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// passwordError is returned when a password doesn't meet the password policy
+type passwordError struct {
+	violations []passwordpolicy.Violation
+}
+
+func (e *passwordError) Error() string {
+	messages := make([]string, len(e.violations))
+	for i, v := range e.violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// checkPassword returns a *passwordError if password can't be set for the account with email.
+// userInputs are other details of the account, like its handle, the password shouldn't be built from.
+func (cfg *Config) checkPassword(password, email string, userInputs ...string) error {
+	if violations := cfg.PasswordPolicy.Check(password, email, userInputs...); len(violations) > 0 {
+		return &passwordError{violations: violations}
+	}
+	return nil
+}
+
+// respondWithPasswordError responds 400 with the password policy violations in err as field
+// errors for field, and reports whether err was a *passwordError
+func respondWithPasswordError(w http.ResponseWriter, err error, field string) bool {
+	var pwErr *passwordError
+	if !errors.As(err, &pwErr) {
+		return false
+	}
+	fieldErrors := make([]fieldError, len(pwErr.violations))
+	for i, v := range pwErr.violations {
+		fieldErrors[i] = fieldError{Code: v.Code, Message: v.Message}
+	}
+	respondWithFieldErrors(w, http.StatusBadRequest, "Password does not meet the requirements", map[string][]fieldError{field: fieldErrors})
+	return true
+}
+
+// upgradePasswordHash rehashes password with the current params when the user's stored hash is
+// bcrypt or cheaper argon2id. It runs after a successful password check, which is the only time the
+// plaintext is known. The update only applies if the hash is unchanged, so a password changed in the
+// meantime is never overwritten, and failures are just logged since the old hash still works.
+func (cfg *Config) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	if !auth.NeedsRehash(user.HashedPassword) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %s: %v", user.ID, err)
+		return
+	}
+	if _, err := cfg.DbQueries.UpgradeUserPasswordHash(ctx, database.UpgradeUserPasswordHashParams{
+		NewHash: hashedPassword,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	}); err != nil {
+		log.Printf("Error storing rehashed password for user %s: %v", user.ID, err)
+	}
+}
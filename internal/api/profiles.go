@@ -0,0 +1,162 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var (
+	errHandleTaken = errors.New("handle is already taken")
+	errEmailTaken  = errors.New("email is already in use")
+)
+
+// Handles that would be confusing next to the /api/users routes
+var reservedHandles = map[string]bool{
+	"me":     true,
+	"admin":  true,
+	"verify": true,
+	"email":  true,
+}
+
+// validateHandle checks a handle is 1-30 ASCII letters, digits or underscores, the same
+// characters a chirp @mention can reference
+func validateHandle(handle string) error {
+	if handle == "" || len(handle) > maxHandleLength {
+		return errors.New("handle must be between 1 and 30 characters")
+	}
+	for _, r := range handle {
+		if !isHandleRune(r) {
+			return errors.New("handle may only contain letters, digits and underscores")
+		}
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return errors.New("handle is reserved")
+	}
+	return nil
+}
+
+// validateProfile checks the free-form public profile fields
+func validateProfile(displayName, bio, avatarURL string) error {
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return errors.New("display name must be at most 50 characters")
+	}
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return errors.New("bio must be at most 160 characters")
+	}
+	if avatarURL != "" {
+		parsed, err := url.Parse(avatarURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return errors.New("avatar URL must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// validateEmail checks that an address is a bare email address without a display name
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
+
+func nullableHandle(handle string) sql.NullString {
+	return sql.NullString{String: handle, Valid: handle != ""}
+}
+
+// profileFields are the optional public profile fields accepted when updating a user,
+// nil fields keep their current value
+type profileFields struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// apply returns update params for user with the supplied profile fields replaced,
+// credentials are carried over unchanged
+func (p profileFields) apply(user database.User) (database.UpdateUserParams, error) {
+	params := database.UpdateUserParams{
+		ID:             user.ID,
+		Email:          user.Email,
+		HashedPassword: user.HashedPassword,
+		UpdatedAt:      time.Now(),
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarUrl:      user.AvatarUrl,
+	}
+	if p.Handle != nil {
+		if *p.Handle != "" {
+			if err := validateHandle(*p.Handle); err != nil {
+				return database.UpdateUserParams{}, err
+			}
+		}
+		params.Handle = nullableHandle(*p.Handle)
+	}
+	if p.DisplayName != nil {
+		params.DisplayName = *p.DisplayName
+	}
+	if p.Bio != nil {
+		params.Bio = *p.Bio
+	}
+	if p.AvatarURL != nil {
+		params.AvatarUrl = *p.AvatarURL
+	}
+	if err := validateProfile(params.DisplayName, params.Bio, params.AvatarUrl); err != nil {
+		return database.UpdateUserParams{}, err
+	}
+	return params, nil
+}
+
+// saveUser writes update and returns the stored user, a clash on the unique
+// handle or email is reported as errHandleTaken or errEmailTaken
+func saveUser(ctx context.Context, q *database.Queries, update database.UpdateUserParams) (database.User, error) {
+	if err := q.UpdateUser(ctx, update); err != nil {
+		return database.User{}, userConflict(err)
+	}
+	return q.GetUserByID(ctx, update.ID)
+}
+
+// userConflict translates unique violations on the users table into errHandleTaken or errEmailTaken
+func userConflict(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "users_handle_lower_idx":
+		return errHandleTaken
+	case "users_email_key":
+		return errEmailTaken
+	}
+	return err
+}
+
+// respondWithUserError responds with 409 for a taken handle or email and 500 otherwise
+func respondWithUserError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errHandleTaken):
+		respondWithError(w, http.StatusConflict, "Handle is already taken")
+	case errors.Is(err, errEmailTaken):
+		respondWithError(w, http.StatusConflict, "Email is already in use")
+	default:
+		respondWithError(w, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// refreshTokenTTL is how long a login lasts, rotation keeps the family's original expiry
+const refreshTokenTTL = 60 * 24 * time.Hour
+
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// issueRefreshToken creates a refresh token in familyID for the client and returns it, only its digest is stored
+func issueRefreshToken(ctx context.Context, q *database.Queries, userID, familyID uuid.UUID, expiresAt time.Time, client clientInfo) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash:  auth.HashToken(token),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		UserID:     userID,
+		ExpiresAt:  expiresAt,
+		FamilyID:   familyID,
+		UserAgent:  client.UserAgent,
+		IpAddress:  client.IPAddress,
+		LastUsedAt: time.Now(),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateRefreshToken retires current and issues its replacement in the same family.
+// If current was already retired, by an earlier refresh or a concurrent one, it returns
+// errRefreshTokenReused.
+func (cfg *Config) rotateRefreshToken(ctx context.Context, current database.RefreshToken, client clientInfo) (string, error) {
+	var next string
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		var err error
+		next, err = issueRefreshToken(ctx, q, current.UserID, current.FamilyID, current.ExpiresAt, client)
+		if err != nil {
+			return err
+		}
+		rows, err := q.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+			TokenHash:  current.TokenHash,
+			RevokedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+			ReplacedBy: sql.NullString{String: auth.HashToken(next), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return errRefreshTokenReused
+		}
+		return nil
+	})
+	return next, err
+}
+
+// revokeRefreshTokenFamily signs out every token descended from the same login
+func (cfg *Config) revokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return cfg.DbQueries.RevokeRefreshTokenFamily(ctx, database.RevokeRefreshTokenFamilyParams{
+		FamilyID:  familyID,
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles a user can hold, stored on the user and copied into access tokens
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permission is something a role allows beyond acting on the user's own data
+type Permission string
+
+// Permissions checked by handlers and RequirePermission
+const (
+	PermModerateChirps Permission = "chirps:moderate"
+	PermViewMetrics    Permission = "admin:metrics"
+	PermResetDatabase  Permission = "admin:reset"
+	PermManageRoles    Permission = "admin:roles"
+	PermUnlockAccounts Permission = "admin:unlock"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:      nil,
+	RoleModerator: {PermModerateChirps},
+	RoleAdmin:     {PermModerateChirps, PermViewMetrics, PermResetDatabase, PermManageRoles, PermUnlockAccounts},
+}
+
+// validateRole reports whether role is one of the known roles
+func validateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return errors.New("role must be user, moderator or admin")
+	}
+	return nil
+}
+
+// Can reports whether the principal's role grants perm
+func (p Principal) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[p.Role], perm)
+}
+
+// principalCan is Can checked against the role the user holds now rather than the one copied
+// into their access token, so a demotion takes effect before the token expires
+func (cfg *Config) principalCan(ctx context.Context, p Principal, perm Permission) (bool, error) {
+	if !p.Can(perm) {
+		return false, nil
+	}
+	user, err := cfg.DbQueries.GetUserByID(ctx, p.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(rolePermissions[user.Role], perm), nil
+}
+
+// RequirePermission only calls next for requests from a logged in user whose role grants perm,
+// personal access tokens are turned away like they are for account management
+func (cfg *Config) RequirePermission(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return cfg.RequireAuth(ScopeAccount, func(w http.ResponseWriter, req *http.Request) {
+		ok, err := cfg.principalCan(req.Context(), mustPrincipal(req), perm)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error checking permissions")
+			return
+		}
+		if !ok {
+			respondWithError(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		next(w, req)
+	})
+}
+
+// CreateAdmin gives the account for email the admin role, creating it with password when it
+// doesn't exist yet. It bootstraps the first admin, who can then promote others over the API.
+func (cfg *Config) CreateAdmin(ctx context.Context, email, password string) (database.User, error) {
+	if err := validateEmail(email); err != nil {
+		return database.User{}, err
+	}
+
+	var user database.User
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		var err error
+		user, err = q.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			if password == "" {
+				return errors.New("no account uses that email, set ADMIN_PASSWORD to create one")
+			}
+			if err := cfg.checkPassword(password, email); err != nil {
+				return fmt.Errorf("ADMIN_PASSWORD: %w", err)
+			}
+			hashedPassword, err := auth.HashPassword(password)
+			if err != nil {
+				return err
+			}
+			user, err = q.CreateUser(ctx, database.CreateUserParams{
+				ID:             uuid.New(),
+				CreatedAt:      time.Now(),
+				UpdatedAt:      time.Now(),
+				Email:          email,
+				HashedPassword: hashedPassword,
+			})
+			if err != nil {
+				return err
+			}
+			// The operator vouches for the address
+			if err := q.SetUserEmailVerified(ctx, database.SetUserEmailVerifiedParams{
+				ID:              user.ID,
+				EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			}); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := q.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+			ID:        user.ID,
+			Role:      RoleAdmin,
+			UpdatedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+		user, err = q.GetUserByID(ctx, user.ID)
+		return err
+	})
+	return user, err
+}
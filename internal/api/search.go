@@ -0,0 +1,105 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchStopwords are the words the english text search configuration drops from a tsquery,
+// a term made only of them matches nothing on its own
+var searchStopwords = func() map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.Fields(`
+		i me my myself we our ours ourselves you your yours yourself yourselves he him his
+		himself she her hers herself it its itself they them their theirs themselves what which
+		who whom this that these those am is are was were be been being have has had having do
+		does did doing a an the and but if or because as until while of at by for with about
+		against between into through during before after above below to from up down in out on
+		off over under again further then once here there when where why how all any both each
+		few more most other some such no nor not only own same so than too very s t can will
+		just don should now`) {
+		words[word] = true
+	}
+	return words
+}()
+
+// buildSearchQuery turns user search input into a Postgres tsquery expression.
+// Words are ANDed together, "quoted phrases" must appear in order, a trailing *
+// matches by prefix and a leading - excludes a word. Returns an empty string
+// when the input has nothing to search for.
+func buildSearchQuery(input string) string {
+	var terms []string
+	positive := false
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		// Quoted phrase
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if words := searchWords(string(runes[i+1 : end])); len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+				positive = positive || hasSearchableWord(words)
+			}
+			i = end + 1
+			continue
+		}
+
+		// Single word with optional - and * modifiers
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+			end++
+		}
+		token := string(runes[i:end])
+		i = end
+		negated := strings.HasPrefix(token, "-")
+		prefix := strings.HasSuffix(token, "*")
+		words := searchWords(token)
+		if len(words) == 0 {
+			continue
+		}
+		searchable := hasSearchableWord(words)
+		if prefix {
+			words[len(words)-1] += ":*"
+		}
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		if negated {
+			term = "!" + term
+		} else {
+			positive = positive || searchable
+		}
+		terms = append(terms, term)
+	}
+
+	// A query made only of exclusions, once stopwords are dropped, would scan every chirp
+	if !positive {
+		return ""
+	}
+	return strings.Join(terms, " & ")
+}
+
+// searchWords splits text into the letter and digit runs that can safely appear in a tsquery
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasSearchableWord reports whether any of words is left once stopwords are dropped
+func hasSearchableWord(words []string) bool {
+	for _, word := range words {
+		if !searchStopwords[word] {
+			return true
+		}
+	}
+	return false
+}
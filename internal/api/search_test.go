@@ -0,0 +1,90 @@
+package api
+
+import "testing"
+
+func TestBuildSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "single word",
+			input: "chirpy",
+			want:  "chirpy",
+		},
+		{
+			name:  "words are anded and lowercased",
+			input: "  Hello   World ",
+			want:  "hello & world",
+		},
+		{
+			name:  "quoted phrase",
+			input: `"good morning" coffee`,
+			want:  "(good <-> morning) & coffee",
+		},
+		{
+			name:  "unterminated phrase runs to the end",
+			input: `"good morning`,
+			want:  "(good <-> morning)",
+		},
+		{
+			name:  "prefix",
+			input: "chirp*",
+			want:  "chirp:*",
+		},
+		{
+			name:  "exclusion",
+			input: "go -java",
+			want:  "go & !java",
+		},
+		{
+			name:  "punctuation splits a word into a phrase",
+			input: "e-mail",
+			want:  "(e <-> mail)",
+		},
+		{
+			name:  "tsquery operators are dropped",
+			input: "cats & !dogs | (birds)",
+			want:  "cats & dogs & birds",
+		},
+		{
+			name:  "unicode letters",
+			input: "Café Ωmega",
+			want:  "café & ωmega",
+		},
+		{
+			name:  "only exclusions",
+			input: "-spam -ads",
+			want:  "",
+		},
+		{
+			name:  "stopwords alongside other words",
+			input: "the cat",
+			want:  "the & cat",
+		},
+		{
+			name:  "stopword beside an exclusion",
+			input: "the -foo",
+			want:  "",
+		},
+		{
+			name:  "phrase of stopwords beside an exclusion",
+			input: `"out of" -foo`,
+			want:  "",
+		},
+		{
+			name:  "nothing searchable",
+			input: `  "" * - !`,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSearchQuery(tt.input); got != tt.want {
+				t.Errorf("buildSearchQuery(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
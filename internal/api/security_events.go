@@ -0,0 +1,64 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types recorded in security_events
+const (
+	securityEventRefreshTokenReuse = "refresh_token_reuse"
+	securityEventIdentityLinked    = "identity_linked"
+	securityEventDataExported      = "data_exported"
+	securityEventDeletionScheduled = "account_deletion_scheduled"
+	securityEventDeletionCancelled = "account_deletion_cancelled"
+	securityEventOAuthReplay       = "oauth_token_replay"
+)
+
+// logSecurityEvent records something security relevant about an account. Failures are only
+// logged, so recording an event never blocks the request that noticed it.
+func (cfg *Config) logSecurityEvent(ctx context.Context, req *http.Request, userID uuid.UUID, eventType, details string) {
+	if err := cfg.DbQueries.CreateSecurityEvent(ctx, database.CreateSecurityEventParams{
+		ID:        uuid.New(),
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		EventType: eventType,
+		Details:   details,
+		IpAddress: clientIP(req),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		log.Printf("Error recording security event %s for user %s: %v", eventType, userID, err)
+	}
+}
+
+// maxUserAgentLength caps what is stored from the User-Agent header
+const maxUserAgentLength = 512
+
+// clientInfo describes the device behind a request, recorded on each session
+type clientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+func clientFromRequest(req *http.Request) clientInfo {
+	userAgent := req.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return clientInfo{UserAgent: strings.ToValidUTF8(userAgent, ""), IPAddress: clientIP(req)}
+}
+
+// clientIP returns the address of the connecting client without its port
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+type threadNode struct {
+	chirpResponse
+	Deleted    bool          `json:"deleted"`
+	Depth      int           `json:"depth"`
+	ReplyCount int           `json:"reply_count"`
+	Replies    []*threadNode `json:"replies"`
+}
+
+// buildThread arranges the chirps of a conversation into a reply tree under its root.
+// Chirps must be ordered oldest first so replies keep their posting order.
+// Responses must line up with chirps. Returns nil when the root is not among the chirps.
+func buildThread(rootID uuid.UUID, chirps []database.Chirp, responses []chirpResponse) *threadNode {
+	nodes := make(map[uuid.UUID]*threadNode, len(chirps))
+	for i, chirp := range chirps {
+		nodes[chirp.ID] = &threadNode{
+			chirpResponse: responses[i],
+			Deleted:       chirp.DeletedAt.Valid,
+			Replies:       []*threadNode{},
+		}
+	}
+
+	// Link replies to their parents, replies whose parent is gone hang off the root
+	root, ok := nodes[rootID]
+	if !ok {
+		return nil
+	}
+	for _, chirp := range chirps {
+		if chirp.ID == rootID {
+			continue
+		}
+		parent := root
+		if chirp.ParentID.Valid {
+			if p, ok := nodes[chirp.ParentID.UUID]; ok {
+				parent = p
+			}
+		}
+		parent.Replies = append(parent.Replies, nodes[chirp.ID])
+		parent.ReplyCount++
+	}
+
+	setThreadDepth(root, 0)
+	return root
+}
+
+func setThreadDepth(node *threadNode, depth int) {
+	node.Depth = depth
+	for _, reply := range node.Replies {
+		setThreadDepth(reply, depth+1)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// threadShape describes a thread as each node's chirp, depth and replies, ignoring the rest
+type threadShape struct {
+	id      uuid.UUID
+	depth   int
+	deleted bool
+	replies []threadShape
+}
+
+// shapeOf also checks that every node counts its replies
+func shapeOf(t *testing.T, node *threadNode) threadShape {
+	t.Helper()
+	if node.ReplyCount != len(node.Replies) {
+		t.Errorf("chirp %s: ReplyCount = %d, want %d", node.ID, node.ReplyCount, len(node.Replies))
+	}
+	shape := threadShape{id: node.ID, depth: node.Depth, deleted: node.Deleted}
+	for _, reply := range node.Replies {
+		shape.replies = append(shape.replies, shapeOf(t, reply))
+	}
+	return shape
+}
+
+func sameShape(a, b threadShape) bool {
+	if a.id != b.id || a.depth != b.depth || a.deleted != b.deleted || len(a.replies) != len(b.replies) {
+		return false
+	}
+	for i := range a.replies {
+		if !sameShape(a.replies[i], b.replies[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuildThread(t *testing.T) {
+	root, a, b, c, d := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	gone := uuid.New()
+	now := time.Now()
+	chirp := func(id uuid.UUID, parent uuid.UUID, deleted bool) database.Chirp {
+		chirp := database.Chirp{ID: id, CreatedAt: now, ParentID: uuid.NullUUID{UUID: parent, Valid: parent != uuid.Nil}}
+		if deleted {
+			chirp.DeletedAt = sql.NullTime{Time: now, Valid: true}
+		}
+		return chirp
+	}
+
+	tests := []struct {
+		name   string
+		rootID uuid.UUID
+		chirps []database.Chirp
+		want   *threadShape
+	}{
+		{
+			name:   "root alone",
+			rootID: root,
+			chirps: []database.Chirp{chirp(root, uuid.Nil, false)},
+			want:   &threadShape{id: root},
+		},
+		{
+			name:   "nested replies keep posting order",
+			rootID: root,
+			chirps: []database.Chirp{
+				chirp(root, uuid.Nil, false),
+				chirp(a, root, false),
+				chirp(b, root, false),
+				chirp(c, a, false),
+				chirp(d, c, false),
+			},
+			want: &threadShape{id: root, replies: []threadShape{
+				{id: a, depth: 1, replies: []threadShape{
+					{id: c, depth: 2, replies: []threadShape{
+						{id: d, depth: 3},
+					}},
+				}},
+				{id: b, depth: 1},
+			}},
+		},
+		{
+			name:   "tombstones stay in place",
+			rootID: root,
+			chirps: []database.Chirp{
+				chirp(root, uuid.Nil, true),
+				chirp(a, root, false),
+			},
+			want: &threadShape{id: root, deleted: true, replies: []threadShape{
+				{id: a, depth: 1},
+			}},
+		},
+		{
+			name:   "replies to a missing parent hang off the root",
+			rootID: root,
+			chirps: []database.Chirp{
+				chirp(root, uuid.Nil, false),
+				chirp(a, gone, false),
+				chirp(b, uuid.Nil, false),
+			},
+			want: &threadShape{id: root, replies: []threadShape{
+				{id: a, depth: 1},
+				{id: b, depth: 1},
+			}},
+		},
+		{
+			name:   "missing root",
+			rootID: root,
+			chirps: []database.Chirp{chirp(a, root, false)},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := make([]chirpResponse, 0, len(tt.chirps))
+			for _, chirp := range tt.chirps {
+				responses = append(responses, newChirpResponse(chirp))
+			}
+			got := buildThread(tt.rootID, tt.chirps, responses)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("buildThread() = %+v, want nil", shapeOf(t, got))
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("buildThread() = nil")
+			}
+			if shape := shapeOf(t, got); !sameShape(shape, *tt.want) {
+				t.Errorf("buildThread() = %+v, want %+v", shape, *tt.want)
+			}
+		})
+	}
+}
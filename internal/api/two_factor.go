@@ -0,0 +1,102 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodeCount = 10
+	// mfaTokenTTL is how long a user has to enter their code after the password step
+	mfaTokenTTL = 5 * time.Minute
+)
+
+// replaceRecoveryCodes swaps the user's recovery codes for a fresh set, only argon2id hashes are stored
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  hash,
+			CreatedAt: time.Now(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// checkSecondFactor verifies either a TOTP code or a recovery code for user and uses it up,
+// so neither can be replayed
+func (cfg *Config) checkSecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if !user.TotpEnabledAt.Valid {
+		return false, nil
+	}
+
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		rows, err := cfg.DbQueries.UseTOTPStep(ctx, database.UseTOTPStepParams{ID: user.ID, TotpLastStep: step})
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+
+	if recoveryCode == "" {
+		return false, nil
+	}
+	recoveryCode = auth.NormalizeRecoveryCode(recoveryCode)
+	stored, err := cfg.DbQueries.GetUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, candidate := range stored {
+		if !auth.CheckPasswordHash(recoveryCode, candidate.CodeHash) {
+			continue
+		}
+		rows, err := cfg.DbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			ID:     candidate.ID,
+			UsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+	return false, nil
+}
+
+// respondWithMFAChallenge answers the first login step of a two-factor account with a short-lived
+// token to exchange, along with a code, at /api/login/2fa
+func (cfg *Config) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	mfaToken, err := auth.MakeMFAToken(user.ID, cfg.JWTKeys, mfaTokenTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate MFA token")
+		return
+	}
+	type mfaResponse struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	respondWithPayload(w, http.StatusOK, mfaResponse{MFARequired: true, MFAToken: mfaToken})
+}
@@ -2,70 +2,198 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
-	if err != nil {
-		return "", err
+// AccessClaims are the claims carried by an access token created by MakeJWT
+type AccessClaims struct {
+	// SessionID identifies the login (refresh token family) the access token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Role is the user's role when the token was issued
+	Role string `json:"role,omitempty"`
+	// ClientID and Scope are set on tokens issued to an OAuth client, Scope is space separated
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWTOption adds optional claims to an access token created by MakeJWT
+type JWTOption func(*AccessClaims)
+
+// WithSessionID ties an access token to the session it was issued for
+func WithSessionID(sessionID uuid.UUID) JWTOption {
+	return func(claims *AccessClaims) {
+		claims.SessionID = sessionID.String()
 	}
-	return hash, nil
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	match, err := argon2id.ComparePasswordAndHash(password, hash)
-	if err != nil {
-		return false
+// WithRole records the user's role in an access token
+func WithRole(role string) JWTOption {
+	return func(claims *AccessClaims) {
+		claims.Role = role
+	}
+}
+
+// WithClient marks an access token as issued to an OAuth client, limited to scopes
+func WithClient(clientID string, scopes []string) JWTOption {
+	return func(claims *AccessClaims) {
+		claims.ClientID = clientID
+		claims.Scope = strings.Join(scopes, " ")
 	}
-	return match
 }
 
 // MakeJWT creates a JWT token for the given user ID
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claim := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+func MakeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration, opts ...JWTOption) (string, error) {
+	claim := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	signed, err := token.SignedString([]byte(tokenSecret))
+	for _, opt := range opts {
+		opt(&claim)
+	}
+	signed, err := keys.sign(claim)
 	if err != nil {
 		return "", err
 	}
 	return signed, nil
 }
 
-// ValidateJWT validates a JWT token and returns the user ID
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// ValidateJWT validates a JWT token against any key in the keyring and returns the user ID
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return claims.UserID()
+}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
+// ParseJWT validates an access token and returns its claims
+func ParseJWT(tokenString string, keys *Keyring) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := keys.parse(tokenString, claims)
+	if err != nil {
+		return nil, err
 	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	// Access tokens carry no audience, anything else was issued for another purpose
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
 
-	id, err := claims.GetSubject()
+// UserID returns the user the token was issued to
+func (c *AccessClaims) UserID() (uuid.UUID, error) {
+	id, err := c.GetSubject()
 	if err != nil {
 		return uuid.Nil, err
 	}
 	return uuid.Parse(id)
 }
 
+// Scopes returns the scopes of a token issued to an OAuth client
+func (c *AccessClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Session returns the session the token was issued for, tokens from before sessions existed have none
+func (c *AccessClaims) Session() uuid.NullUUID {
+	id, err := uuid.Parse(c.SessionID)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}
+}
+
+const emailVerificationAudience = "chirpy-email-verification"
+
+type emailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailVerificationToken creates a signed token proving the user owns email.
+// The token ID lets the caller record the token so it can only be used once.
+func MakeEmailVerificationToken(userID, tokenID uuid.UUID, email string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := emailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        tokenID.String(),
+		},
+	}
+	return keys.sign(claims)
+}
+
+// ValidateEmailVerificationToken returns the user ID, token ID and email address of a token
+// created by MakeEmailVerificationToken
+func ValidateEmailVerificationToken(tokenString string, keys *Keyring) (uuid.UUID, uuid.UUID, string, error) {
+	claims := &emailVerificationClaims{}
+	token, err := keys.parse(tokenString, claims, jwt.WithAudience(emailVerificationAudience))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+	if !token.Valid {
+		return uuid.Nil, uuid.Nil, "", errors.New("invalid token")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+	return userID, tokenID, claims.Email, nil
+}
+
+const mfaAudience = "chirpy-mfa"
+
+// MakeMFAToken creates a short-lived token showing the user passed the password step of a
+// two-factor login. It is not accepted by ValidateJWT.
+func MakeMFAToken(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claim := jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+	return keys.sign(claim)
+}
+
+// ValidateMFAToken validates a token created by MakeMFAToken and returns the user ID
+func ValidateMFAToken(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := keys.parse(tokenString, claims, jwt.WithAudience(mfaAudience))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !token.Valid {
+		return uuid.Nil, errors.New("invalid token")
+	}
+	return uuid.Parse(claims.Subject)
+}
+
 // GetBearerToken returns the token from the Authorization header
 func GetBearerToken(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
@@ -84,6 +212,30 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(key), nil
 }
 
+// PersonalAccessTokenPrefix starts every personal access token, so they are easy to tell apart
+// from JWTs and to spot in leaked logs or code
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken generates a random personal access token
+func MakePersonalAccessToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + hex.EncodeToString(key), nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access token rather than a JWT
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashToken returns the SHA-256 digest of an opaque token, so only the digest needs to be stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetAPIKey returns the API key from the Authorization header
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
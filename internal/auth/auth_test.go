@@ -220,7 +220,7 @@ func TestMakeJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := MakeJWT(tt.userID, tt.secret, tt.expiresIn)
+			token, err := MakeJWT(tt.userID, NewHMACKeyring(tt.secret), tt.expiresIn)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("MakeJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -245,14 +245,14 @@ func TestMakeJWT_UniqueTokens(t *testing.T) {
 	expiresIn := time.Hour
 
 	// Create two tokens at slightly different times
-	token1, err := MakeJWT(userID, secret, expiresIn)
+	token1, err := MakeJWT(userID, NewHMACKeyring(secret), expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
 	time.Sleep(1 * time.Second) // Need to sleep at least 1 second since JWT timestamps are in seconds
 
-	token2, err := MakeJWT(userID, secret, expiresIn)
+	token2, err := MakeJWT(userID, NewHMACKeyring(secret), expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
@@ -269,12 +269,12 @@ func TestMakeJWT_DeterministicForSameTime(t *testing.T) {
 	expiresIn := time.Hour
 
 	// Create two tokens immediately one after another
-	token1, err := MakeJWT(userID, secret, expiresIn)
+	token1, err := MakeJWT(userID, NewHMACKeyring(secret), expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
-	token2, err := MakeJWT(userID, secret, expiresIn)
+	token2, err := MakeJWT(userID, NewHMACKeyring(secret), expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
@@ -294,13 +294,13 @@ func TestValidateJWT(t *testing.T) {
 	differentSecret := "different-secret"
 
 	// Create a valid token
-	validToken, err := MakeJWT(testUserID, testSecret, time.Hour)
+	validToken, err := MakeJWT(testUserID, NewHMACKeyring(testSecret), time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to setup test: %v", err)
 	}
 
 	// Create an expired token
-	expiredToken, err := MakeJWT(testUserID, testSecret, -time.Hour)
+	expiredToken, err := MakeJWT(testUserID, NewHMACKeyring(testSecret), -time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to setup test: %v", err)
 	}
@@ -365,7 +365,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.secret)
+			gotUserID, err := ValidateJWT(tt.tokenString, NewHMACKeyring(tt.secret))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -401,13 +401,13 @@ func TestMakeJWT_ValidateJWT_Integration(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a token
-			token, err := MakeJWT(tt.userID, tt.secret, tt.expiresIn)
+			token, err := MakeJWT(tt.userID, NewHMACKeyring(tt.secret), tt.expiresIn)
 			if err != nil {
 				t.Fatalf("MakeJWT() error = %v", err)
 			}
 
 			// Validate the token
-			userID, err := ValidateJWT(token, tt.secret)
+			userID, err := ValidateJWT(token, NewHMACKeyring(tt.secret))
 			if err != nil {
 				t.Fatalf("ValidateJWT() error = %v", err)
 			}
@@ -426,13 +426,13 @@ func TestValidateJWT_DifferentSecrets(t *testing.T) {
 	secret2 := "secret-two"
 
 	// Create token with secret1
-	token, err := MakeJWT(userID, secret1, time.Hour)
+	token, err := MakeJWT(userID, NewHMACKeyring(secret1), time.Hour)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
 	// Validate with secret1 should succeed
-	gotUserID, err := ValidateJWT(token, secret1)
+	gotUserID, err := ValidateJWT(token, NewHMACKeyring(secret1))
 	if err != nil {
 		t.Errorf("ValidateJWT() with correct secret failed: %v", err)
 	}
@@ -441,7 +441,7 @@ func TestValidateJWT_DifferentSecrets(t *testing.T) {
 	}
 
 	// Validate with secret2 should fail
-	_, err = ValidateJWT(token, secret2)
+	_, err = ValidateJWT(token, NewHMACKeyring(secret2))
 	if err == nil {
 		t.Error("ValidateJWT() with wrong secret should have failed")
 	}
@@ -623,3 +623,207 @@ func TestGetAPIKey(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("some-token")
+	if len(hash) != 64 {
+		t.Errorf("HashToken() returned %d characters, want 64", len(hash))
+	}
+	if hash != HashToken("some-token") {
+		t.Error("HashToken() should be deterministic")
+	}
+	if hash == HashToken("other-token") {
+		t.Error("HashToken() returned the same digest for different tokens")
+	}
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	userID := uuid.New()
+	tokenID := uuid.New()
+	secret := "test-secret"
+
+	token, err := MakeEmailVerificationToken(userID, tokenID, "user@example.com", NewHMACKeyring(secret), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken() error = %v", err)
+	}
+
+	gotUserID, gotTokenID, gotEmail, err := ValidateEmailVerificationToken(token, NewHMACKeyring(secret))
+	if err != nil {
+		t.Fatalf("ValidateEmailVerificationToken() error = %v", err)
+	}
+	if gotUserID != userID || gotTokenID != tokenID || gotEmail != "user@example.com" {
+		t.Errorf("ValidateEmailVerificationToken() = %v, %v, %q", gotUserID, gotTokenID, gotEmail)
+	}
+
+	if _, _, _, err := ValidateEmailVerificationToken(token, NewHMACKeyring("wrong-secret")); err == nil {
+		t.Error("ValidateEmailVerificationToken() with wrong secret should have failed")
+	}
+
+	expired, err := MakeEmailVerificationToken(userID, tokenID, "user@example.com", NewHMACKeyring(secret), -time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken() error = %v", err)
+	}
+	if _, _, _, err := ValidateEmailVerificationToken(expired, NewHMACKeyring(secret)); err == nil {
+		t.Error("ValidateEmailVerificationToken() with expired token should have failed")
+	}
+}
+
+func TestEmailVerificationToken_NotAnAccessToken(t *testing.T) {
+	secret := "test-secret"
+	userID := uuid.New()
+
+	verification, err := MakeEmailVerificationToken(userID, uuid.New(), "user@example.com", NewHMACKeyring(secret), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken() error = %v", err)
+	}
+	if _, err := ValidateJWT(verification, NewHMACKeyring(secret)); err == nil {
+		t.Error("ValidateJWT() should reject an email verification token")
+	}
+
+	access, err := MakeJWT(userID, NewHMACKeyring(secret), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if _, _, _, err := ValidateEmailVerificationToken(access, NewHMACKeyring(secret)); err == nil {
+		t.Error("ValidateEmailVerificationToken() should reject an access token")
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	secret := "test-secret"
+	userID := uuid.New()
+
+	token, err := MakeMFAToken(userID, NewHMACKeyring(secret), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAToken() error = %v", err)
+	}
+	gotUserID, err := ValidateMFAToken(token, NewHMACKeyring(secret))
+	if err != nil {
+		t.Fatalf("ValidateMFAToken() error = %v", err)
+	}
+	if gotUserID != userID {
+		t.Errorf("ValidateMFAToken() = %v, want %v", gotUserID, userID)
+	}
+
+	// An MFA token must never work as an access token, and the reverse
+	if _, err := ValidateJWT(token, NewHMACKeyring(secret)); err == nil {
+		t.Error("ValidateJWT() should reject an MFA token")
+	}
+	access, err := MakeJWT(userID, NewHMACKeyring(secret), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if _, err := ValidateMFAToken(access, NewHMACKeyring(secret)); err == nil {
+		t.Error("ValidateMFAToken() should reject an access token")
+	}
+}
+
+func TestParseJWT_SessionID(t *testing.T) {
+	secret := "test-secret"
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := MakeJWT(userID, NewHMACKeyring(secret), time.Hour, WithSessionID(sessionID))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, NewHMACKeyring(secret))
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if gotUserID, err := claims.UserID(); err != nil || gotUserID != userID {
+		t.Errorf("UserID() = %v, %v, want %v", gotUserID, err, userID)
+	}
+	if got := claims.Session(); !got.Valid || got.UUID != sessionID {
+		t.Errorf("Session() = %v, want %v", got, sessionID)
+	}
+
+	// Tokens without a session still validate
+	plain, err := MakeJWT(userID, NewHMACKeyring(secret), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err = ParseJWT(plain, NewHMACKeyring(secret))
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Session().Valid {
+		t.Error("Session() should be empty for a token made without WithSessionID")
+	}
+}
+
+func TestParseJWT_Role(t *testing.T) {
+	keys := NewHMACKeyring("test-secret")
+	token, err := MakeJWT(uuid.New(), keys, time.Hour, WithRole("moderator"))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Role != "moderator" {
+		t.Errorf("Role = %q, want moderator", claims.Role)
+	}
+
+	plain, err := MakeJWT(uuid.New(), keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err = ParseJWT(plain, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Role != "" {
+		t.Errorf("Role = %q, want empty for a token made without WithRole", claims.Role)
+	}
+}
+
+func TestParseJWT_Client(t *testing.T) {
+	keys := NewHMACKeyring("test-secret")
+	userID := uuid.New()
+	token, err := MakeJWT(userID, keys, time.Hour, WithClient("client-1", []string{"chirps:read", "chirps:write"}))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	// Client tokens are still ordinary access tokens
+	if got, err := ValidateJWT(token, keys); err != nil || got != userID {
+		t.Fatalf("ValidateJWT() = %v, %v, want %v", got, err, userID)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.ClientID != "client-1" || claims.Scope != "chirps:read chirps:write" {
+		t.Errorf("claims = %q, %q, want client-1 with both scopes", claims.ClientID, claims.Scope)
+	}
+	if got := claims.Scopes(); len(got) != 2 || got[0] != "chirps:read" || got[1] != "chirps:write" {
+		t.Errorf("Scopes() = %v", got)
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("MakePersonalAccessToken() = %q, missing the %q prefix", token, PersonalAccessTokenPrefix)
+	}
+	other, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if token == other {
+		t.Error("MakePersonalAccessToken() generated identical tokens")
+	}
+
+	jwtToken, err := MakeJWT(uuid.New(), NewHMACKeyring("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if IsPersonalAccessToken(jwtToken) {
+		t.Error("IsPersonalAccessToken() reported a JWT as a personal access token")
+	}
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// SigningKey is one key in a Keyring. Keys without a private half can only verify tokens.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	private   interface{}
+	public    interface{}
+}
+
+// NewHMACKey returns an HS256 key for secret. Its ID is derived from the secret, so the same
+// secret always gets the same kid without revealing it.
+func NewHMACKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(append([]byte("chirpy-kid:"), secret...))
+	return &SigningKey{
+		ID:        "hs256-" + hex.EncodeToString(sum[:8]),
+		Algorithm: AlgHS256,
+		private:   secret,
+		public:    secret,
+	}
+}
+
+// NewEd25519Key returns an EdDSA key identified by its JWK thumbprint
+func NewEd25519Key(private ed25519.PrivateKey) *SigningKey {
+	key := newPublicKey(private.Public())
+	key.private = private
+	return key
+}
+
+// NewRSAKey returns an RS256 key identified by its JWK thumbprint
+func NewRSAKey(private *rsa.PrivateKey) *SigningKey {
+	key := newPublicKey(&private.PublicKey)
+	key.private = private
+	return key
+}
+
+// ParsePEMKey reads an Ed25519 or RSA key from PEM. Private keys (PKCS #8, or PKCS #1 for RSA)
+// can sign, public keys (PKIX) only verify.
+func ParsePEMKey(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch private := parsed.(type) {
+		case ed25519.PrivateKey:
+			return NewEd25519Key(private), nil
+		case *rsa.PrivateKey:
+			return NewRSAKey(private), nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAKey(private), nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key := newPublicKey(parsed)
+		if key == nil {
+			return nil, fmt.Errorf("unsupported public key type %T", parsed)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func newPublicKey(public crypto.PublicKey) *SigningKey {
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		key := &SigningKey{Algorithm: AlgEdDSA, public: public}
+		key.ID = key.JWK().thumbprint()
+		return key
+	case *rsa.PublicKey:
+		key := &SigningKey{Algorithm: AlgRS256, public: public}
+		key.ID = key.JWK().thumbprint()
+		return key
+	}
+	return nil
+}
+
+// CanSign reports whether the private half of the key is available
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodHS256
+}
+
+// JWK is the public JSON Web Key form of a SigningKey (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key as a JWK, HMAC keys have no public form and return an empty JWK
+func (k *SigningKey) JWK() JWK {
+	switch public := k.public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: k.ID, Use: "sig", Alg: AlgEdDSA, Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(public)}
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: k.ID, Use: "sig", Alg: AlgRS256,
+			N: base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, used as the kid of asymmetric keys
+func (j JWK) thumbprint() string {
+	var members interface{}
+	switch j.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Keyring holds the keys Chirpy tokens are signed and verified with. New tokens are signed
+// with the signing key and carry its kid; tokens signed by any key in the ring still verify,
+// so a retired key can stay until the tokens it signed have expired.
+type Keyring struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewKeyring returns a keyring that signs with signing and also accepts tokens from verifyOnly
+func NewKeyring(signing *SigningKey, verifyOnly ...*SigningKey) (*Keyring, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must include a private key")
+	}
+	ring := &Keyring{signing: signing, keys: map[string]*SigningKey{}}
+	for _, key := range append([]*SigningKey{signing}, verifyOnly...) {
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %s", key.ID)
+		}
+		ring.keys[key.ID] = key
+	}
+	return ring, nil
+}
+
+// NewHMACKeyring returns a keyring holding a single HS256 key for secret
+func NewHMACKeyring(secret string) *Keyring {
+	key := NewHMACKey([]byte(secret))
+	return &Keyring{signing: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+// JWKS returns the public keys of the ring sorted by kid, so the document is the same on every
+// request and every instance. HMAC keys are never published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if jwk := key.JWK(); jwk.Kty != "" {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return set
+}
+
+// sign signs claims with the signing key and records its kid in the header
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method(), claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.private)
+}
+
+// parse validates tokenString against the key named by its kid header. The key must use the
+// algorithm the token claims, so an RSA public key can never be used as an HMAC secret.
+func (k *Keyring) parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key, err := k.lookup(token)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("token algorithm does not match key")
+		}
+		return key.public, nil
+	}, append(opts, jwt.WithValidMethods([]string{AlgHS256, AlgEdDSA, AlgRS256}))...)
+}
+
+func (k *Keyring) lookup(token *jwt.Token) (*SigningKey, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		// Tokens issued before key IDs were added were signed with the HMAC secret
+		if k.signing.Algorithm == AlgHS256 {
+			return k.signing, nil
+		}
+		for _, key := range k.keys {
+			if key.Algorithm == AlgHS256 {
+				return key, nil
+			}
+		}
+		return nil, errors.New("token has no key ID")
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %s", kid)
+	}
+	return key, nil
+}
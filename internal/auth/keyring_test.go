@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestEd25519Key(t *testing.T) *SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	return NewEd25519Key(private)
+}
+
+func newTestRSAKey(t *testing.T) *SigningKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	return NewRSAKey(private)
+}
+
+func TestKeyring_SignAndVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *SigningKey
+	}{
+		{name: "HS256", key: NewHMACKey([]byte("secret"))},
+		{name: "EdDSA", key: newTestEd25519Key(t)},
+		{name: "RS256", key: newTestRSAKey(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeyring(tt.key)
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+			userID := uuid.New()
+			token, err := MakeJWT(userID, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified() error = %v", err)
+			}
+			if parsed.Header["kid"] != tt.key.ID || parsed.Header["alg"] != tt.key.Algorithm {
+				t.Errorf("header = %v, want kid %s and alg %s", parsed.Header, tt.key.ID, tt.key.Algorithm)
+			}
+
+			gotUserID, err := ValidateJWT(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateJWT() error = %v", err)
+			}
+			if gotUserID != userID {
+				t.Errorf("ValidateJWT() = %v, want %v", gotUserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey := NewHMACKey([]byte("old-secret"))
+	oldKeys, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	userID := uuid.New()
+	oldToken, err := MakeJWT(userID, oldKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	// A new signing key with the old one kept for verification accepts both generations
+	rotated, err := NewKeyring(newTestEd25519Key(t), oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if _, err := ValidateJWT(oldToken, rotated); err != nil {
+		t.Errorf("ValidateJWT() rejected a token from a retired key: %v", err)
+	}
+	newToken, err := MakeJWT(userID, rotated, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if _, err := ValidateJWT(newToken, rotated); err != nil {
+		t.Errorf("ValidateJWT() rejected a token from the signing key: %v", err)
+	}
+
+	// Once the old key is dropped its tokens stop working
+	dropped, err := NewKeyring(newTestEd25519Key(t))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if _, err := ValidateJWT(oldToken, dropped); err == nil {
+		t.Error("ValidateJWT() accepted a token from a key that is no longer in the ring")
+	}
+}
+
+func TestKeyring_LegacyTokenWithoutKid(t *testing.T) {
+	secret := "legacy-secret"
+	userID := uuid.New()
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		Subject:   userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token, err := legacy.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	keys, err := NewKeyring(newTestEd25519Key(t), NewHMACKey([]byte(secret)))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	gotUserID, err := ValidateJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ValidateJWT() rejected a token issued before key IDs: %v", err)
+	}
+	if gotUserID != userID {
+		t.Errorf("ValidateJWT() = %v, want %v", gotUserID, userID)
+	}
+}
+
+func TestKeyring_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	keys, err := NewKeyring(rsaKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	// An HS256 token "signed" with the published RSA public key must not verify
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.public)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	forged.Header["kid"] = rsaKey.ID
+	token, err := forged.SignedString(publicDER)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("ValidateJWT() accepted an HS256 token for an RSA key")
+	}
+}
+
+func TestNewKeyring_Errors(t *testing.T) {
+	publicOnly := newPublicKey(newTestEd25519Key(t).public)
+	if _, err := NewKeyring(publicOnly); err == nil {
+		t.Error("NewKeyring() accepted a signing key without a private key")
+	}
+	key := NewHMACKey([]byte("secret"))
+	if _, err := NewKeyring(key, NewHMACKey([]byte("secret"))); err == nil {
+		t.Error("NewKeyring() accepted duplicate key IDs")
+	}
+}
+
+func TestParsePEMKey(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+
+	signing, err := ParsePEMKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() private error = %v", err)
+	}
+	verifying, err := ParsePEMKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() public error = %v", err)
+	}
+	if !signing.CanSign() || verifying.CanSign() {
+		t.Error("only the private key should be able to sign")
+	}
+	if signing.ID != verifying.ID || signing.Algorithm != AlgEdDSA {
+		t.Errorf("ParsePEMKey() IDs %s and %s differ or algorithm %s is wrong", signing.ID, verifying.ID, signing.Algorithm)
+	}
+
+	if _, err := ParsePEMKey([]byte("not a key")); err == nil {
+		t.Error("ParsePEMKey() accepted data without a PEM block")
+	}
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	edKey := newTestEd25519Key(t)
+	rsaKey := newTestRSAKey(t)
+	keys, err := NewKeyring(edKey, rsaKey, NewHMACKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2 (HMAC keys are never published)", len(set.Keys))
+	}
+	if set.Keys[0].Kid >= set.Keys[1].Kid {
+		t.Errorf("JWKS() kids %s and %s are not sorted", set.Keys[0].Kid, set.Keys[1].Kid)
+	}
+	byKid := map[string]JWK{}
+	for _, jwk := range set.Keys {
+		byKid[jwk.Kid] = jwk
+	}
+	if jwk := byKid[edKey.ID]; jwk.Kty != "OKP" || jwk.Crv != "Ed25519" {
+		t.Errorf("JWKS() Ed25519 key = %+v, want the Ed25519 signing key", jwk)
+	}
+	if jwk := byKid[rsaKey.ID]; jwk.Kty != "RSA" || jwk.E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v, want the RSA key", jwk)
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 7638 section 3.1
+			name: "RSA",
+			jwk: JWK{
+				Kty: "RSA",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037 appendix A.3
+			name: "Ed25519",
+			jwk:  JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.jwk.thumbprint(); got != tt.want {
+				t.Errorf("thumbprint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/alexedwards/argon2id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordParams are the argon2id costs new password hashes are created with
+type PasswordParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams are the argon2id library defaults passwords have always been hashed with
+var DefaultPasswordParams = PasswordParams{
+	Memory:      argon2id.DefaultParams.Memory,
+	Iterations:  argon2id.DefaultParams.Iterations,
+	Parallelism: argon2id.DefaultParams.Parallelism,
+}
+
+const (
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+)
+
+var passwordParams = DefaultPasswordParams
+
+// SetPasswordParams changes the costs HashPassword uses. It is meant to be called once at startup,
+// existing hashes keep verifying and NeedsRehash reports the ones that are now too cheap.
+func SetPasswordParams(params PasswordParams) error {
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return errors.New("argon2id iterations and parallelism must be at least 1")
+	}
+	// Argon2 needs at least 8 KiB per lane
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return errors.New("argon2id memory must be at least 8 KiB per unit of parallelism")
+	}
+	passwordParams = params
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := argon2id.CreateHash(password, &argon2id.Params{
+		Memory:      passwordParams.Memory,
+		Iterations:  passwordParams.Iterations,
+		Parallelism: passwordParams.Parallelism,
+		SaltLength:  passwordSaltLength,
+		KeyLength:   passwordKeyLength,
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// CheckPasswordHash reports whether password matches hash, an argon2id hash or a bcrypt hash
+// imported from the old system
+func CheckPasswordHash(password, hash string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	match, err := argon2id.ComparePasswordAndHash(password, hash)
+	if err != nil {
+		return false
+	}
+	return match
+}
+
+// NeedsRehash reports whether hash should be replaced with a fresh HashPassword of the same
+// password: bcrypt hashes always, argon2id hashes when they are cheaper than the current params.
+// Parallelism only changes how the work is split, so a different value alone doesn't count.
+func NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		return true
+	}
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.KeyLength < passwordKeyLength ||
+		params.SaltLength < passwordSaltLength
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// withPasswordParams sets the hashing params for the rest of the test
+func withPasswordParams(t *testing.T, params PasswordParams) {
+	t.Helper()
+	previous := passwordParams
+	if err := SetPasswordParams(params); err != nil {
+		t.Fatalf("SetPasswordParams() error = %v", err)
+	}
+	t.Cleanup(func() { passwordParams = previous })
+}
+
+func TestHashPassword_UsesParams(t *testing.T) {
+	withPasswordParams(t, PasswordParams{Memory: 32 * 1024, Iterations: 2, Parallelism: 1})
+
+	hash, err := HashPassword("hunter22")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=32768,t=2,p=1$") {
+		t.Errorf("HashPassword() = %s, want it made with the configured params", hash)
+	}
+	if !CheckPasswordHash("hunter22", hash) {
+		t.Error("CheckPasswordHash() rejected the password")
+	}
+}
+
+func TestSetPasswordParams_Invalid(t *testing.T) {
+	tests := []PasswordParams{
+		{Memory: 64 * 1024, Iterations: 0, Parallelism: 1},
+		{Memory: 64 * 1024, Iterations: 1, Parallelism: 0},
+		{Memory: 15, Iterations: 1, Parallelism: 2},
+	}
+	for _, params := range tests {
+		if err := SetPasswordParams(params); err == nil {
+			t.Errorf("SetPasswordParams(%+v) accepted invalid params", params)
+			passwordParams = DefaultPasswordParams
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	withPasswordParams(t, PasswordParams{Memory: 16 * 1024, Iterations: 1, Parallelism: 1})
+	weak, _ := HashPassword("hunter22")
+	withPasswordParams(t, PasswordParams{Memory: 16 * 1024, Iterations: 1, Parallelism: 4})
+	otherParallelism, _ := HashPassword("hunter22")
+	withPasswordParams(t, PasswordParams{Memory: 32 * 1024, Iterations: 2, Parallelism: 1})
+	current, _ := HashPassword("hunter22")
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("hunter22"), bcrypt.MinCost)
+
+	if NeedsRehash(current) {
+		t.Error("NeedsRehash() = true for a hash made with the current params")
+	}
+	if !NeedsRehash(weak) {
+		t.Error("NeedsRehash() = false for a hash with less memory and iterations")
+	}
+	if !NeedsRehash(otherParallelism) {
+		t.Error("NeedsRehash() = false for a cheaper hash with more parallelism")
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash() = false for a bcrypt hash")
+	}
+	if NeedsRehash("not-a-valid-hash") {
+		t.Error("NeedsRehash() = true for something that isn't a hash")
+	}
+
+	// Stronger hashes than configured are left alone
+	withPasswordParams(t, PasswordParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1})
+	if NeedsRehash(current) {
+		t.Error("NeedsRehash() = true for a hash stronger than the current params")
+	}
+}
+
+func TestCheckPasswordHash_Bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("legacyPassword1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	if !CheckPasswordHash("legacyPassword1", string(hash)) {
+		t.Error("CheckPasswordHash() rejected the right password for a bcrypt hash")
+	}
+	if CheckPasswordHash("wrongPassword", string(hash)) {
+		t.Error("CheckPasswordHash() accepted the wrong password for a bcrypt hash")
+	}
+
+	// Hashes from PHP's password_hash use the $2y$ prefix
+	y := "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+	if !CheckPasswordHash("legacyPassword1", y) {
+		t.Error("CheckPasswordHash() rejected a $2y$ bcrypt hash")
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Errorf("PKCEChallenge() = %s, want %s", got, challenge)
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE() rejected the RFC 7636 example")
+	}
+	if VerifyPKCE(verifier, PKCEChallenge(verifier+"x")) {
+		t.Error("VerifyPKCE() accepted a challenge for another verifier")
+	}
+	// A plain challenge must not verify against itself
+	if VerifyPKCE(verifier, verifier) {
+		t.Error("VerifyPKCE() accepted the verifier as its own challenge")
+	}
+}
+
+func TestValidPKCEVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "minimum length", verifier: strings.Repeat("a", 43), want: true},
+		{name: "maximum length", verifier: strings.Repeat("a", 128), want: true},
+		{name: "unreserved characters", verifier: "AZaz09-._~" + strings.Repeat("x", 33), want: true},
+		{name: "too short", verifier: strings.Repeat("a", 42), want: false},
+		{name: "too long", verifier: strings.Repeat("a", 129), want: false},
+		{name: "reserved character", verifier: strings.Repeat("a", 42) + "+", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidPKCEVerifier(tt.verifier); got != tt.want {
+				t.Errorf("ValidPKCEVerifier(%q) = %v, want %v", tt.verifier, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package lockout slows down password guessing. Every failed attempt is counted against a key,
+// such as an account or a client IP, and once a key has used up its free attempts each further
+// attempt has to wait twice as long as the last, up to a temporary lockout.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Record is the failure count of one key
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps failure records. Implementations must count concurrent attempts for the same key
+// without losing any, and Reserve must check and count in one step, otherwise parallel guesses
+// would slip past the limit.
+type Store interface {
+	// Get returns the record for key, the zero Record when there is none
+	Get(ctx context.Context, key string) (Record, error)
+	// Reserve counts an attempt for key at now as a failure when policy lets key try again at now.
+	// Counting starts over when the previous failure is older than policy.Window. It reports
+	// whether the attempt was counted and returns the record either way.
+	Reserve(ctx context.Context, key string, now time.Time, policy Policy) (Record, bool, error)
+	// Release takes back one attempt counted by Reserve
+	Release(ctx context.Context, key string) error
+	// Reset forgets every failure for key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy is how many failures a key gets before it is slowed down, and by how much
+type Policy struct {
+	// FreeAttempts is the number of failures allowed before any delay
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts, doubling from there
+	BaseDelay time.Duration
+	// MaxDelay caps the delay, once reached every further failure locks the key out this long
+	MaxDelay time.Duration
+	// Window is how long failures are remembered
+	Window time.Duration
+}
+
+// Delay returns how long a key with failures has to wait after its last failure
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Wait returns how long a key with record has to wait at now before its next attempt
+func (p Policy) Wait(record Record, now time.Time) time.Duration {
+	if record.Failures == 0 || now.Sub(record.LastFailure) > p.Window {
+		return 0
+	}
+	wait := record.LastFailure.Add(p.Delay(record.Failures)).Sub(now)
+	return max(wait, 0)
+}
+
+// Limiter applies a Policy to the records in a Store
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// NewLimiter returns a limiter that keeps its records in store
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Attempt is called before an attempt's credentials are checked. It counts the attempt as a
+// failure and returns zero, or, when key has to wait first, counts nothing and returns the wait.
+// Checking and counting happen in one step, so a burst of parallel guesses gets no further than
+// the same guesses one after another. Succeed takes the attempt back if it turns out right.
+func (l *Limiter) Attempt(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	record, reserved, err := l.store.Reserve(ctx, key, now, l.policy)
+	if err != nil {
+		return 0, err
+	}
+	if reserved {
+		return 0, nil
+	}
+	// A reset since the store turned the attempt down can leave nothing to wait for, the attempt
+	// is still refused
+	return max(l.policy.Wait(record, now), time.Second), nil
+}
+
+// Succeed takes back an attempt counted by Attempt whose credentials were right
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	return l.store.Release(ctx, key)
+}
+
+// Reset clears key after a successful attempt or when an admin unlocks it
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
@@ -0,0 +1,262 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	Window:       time.Hour,
+}
+
+// newTestLimiter returns a limiter on a memory store whose clock the test moves by hand
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 1000, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// waitFor returns how long key has to wait at the limiter's current time
+func waitFor(t *testing.T, limiter *Limiter, key string) time.Duration {
+	t.Helper()
+	record, err := limiter.store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return limiter.policy.Wait(record, limiter.now())
+}
+
+// failAttempts makes n wrong attempts for key, moving the clock past every delay on the way
+func failAttempts(t *testing.T, limiter *Limiter, now *time.Time, key string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		*now = now.Add(waitFor(t, limiter, key))
+		if wait, err := limiter.Attempt(context.Background(), key); err != nil || wait != 0 {
+			t.Fatalf("Attempt() #%d = %v, %v, want no delay", i+1, wait, err)
+		}
+	}
+}
+
+func TestLimiter_Backoff(t *testing.T) {
+	limiter, now := newTestLimiter()
+
+	failAttempts(t, limiter, now, "account:a", testPolicy.FreeAttempts)
+	if wait := waitFor(t, limiter, "account:a"); wait != 0 {
+		t.Fatalf("wait after the free attempts = %v, want 0", wait)
+	}
+	failAttempts(t, limiter, now, "account:a", 1)
+
+	if wait := waitFor(t, limiter, "account:a"); wait != time.Second {
+		t.Errorf("wait = %v, want 1s", wait)
+	}
+	*now = now.Add(400 * time.Millisecond)
+	if wait := waitFor(t, limiter, "account:a"); wait != 600*time.Millisecond {
+		t.Errorf("wait = %v, want 600ms", wait)
+	}
+	*now = now.Add(time.Second)
+	if wait := waitFor(t, limiter, "account:a"); wait != 0 {
+		t.Errorf("wait = %v after the delay passed, want 0", wait)
+	}
+
+	// Other keys are unaffected
+	if wait := waitFor(t, limiter, "account:b"); wait != 0 {
+		t.Errorf("wait for another key = %v, want 0", wait)
+	}
+}
+
+func TestLimiter_Lockout(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+
+	failAttempts(t, limiter, now, "ip:192.0.2.1", 20)
+	if wait := waitFor(t, limiter, "ip:192.0.2.1"); wait != testPolicy.MaxDelay {
+		t.Errorf("wait = %v, want the lockout of %v", wait, testPolicy.MaxDelay)
+	}
+
+	// An admin unlock clears the lockout immediately
+	if err := limiter.Reset(ctx, "ip:192.0.2.1"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if wait, _ := limiter.Attempt(ctx, "ip:192.0.2.1"); wait != 0 {
+		t.Errorf("Attempt() after Reset() = %v, want 0", wait)
+	}
+	if record, _ := limiter.store.Get(ctx, "ip:192.0.2.1"); record.Failures != 1 {
+		t.Errorf("Failures after Reset() = %d, want a fresh count", record.Failures)
+	}
+
+	// Failures older than the window are forgotten
+	failAttempts(t, limiter, now, "ip:192.0.2.1", 20)
+	*now = now.Add(testPolicy.Window + time.Second)
+	if wait := waitFor(t, limiter, "ip:192.0.2.1"); wait != 0 {
+		t.Errorf("wait after the window = %v, want 0", wait)
+	}
+	limiter.Attempt(ctx, "ip:192.0.2.1")
+	if record, _ := limiter.store.Get(ctx, "ip:192.0.2.1"); record.Failures != 1 {
+		t.Errorf("Failures after the window = %d, want the count to start over", record.Failures)
+	}
+}
+
+func TestLimiter_Attempt(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newTestLimiter()
+
+	// Every attempt counts until it is taken back, so the free attempts plus the one that
+	// earns the first delay get through
+	for i := 0; i <= testPolicy.FreeAttempts; i++ {
+		if wait, err := limiter.Attempt(ctx, "account:a"); err != nil || wait != 0 {
+			t.Fatalf("Attempt() #%d = %v, %v, want no delay", i+1, wait, err)
+		}
+	}
+	if wait, _ := limiter.Attempt(ctx, "account:a"); wait != time.Second {
+		t.Fatalf("Attempt() after the free attempts = %v, want 1s", wait)
+	}
+	// A refused attempt is not counted, so it doesn't push the delay further
+	if wait := waitFor(t, limiter, "account:a"); wait != time.Second {
+		t.Errorf("wait after a refused attempt = %v, want 1s", wait)
+	}
+
+	*now = now.Add(time.Second)
+	if wait, _ := limiter.Attempt(ctx, "account:a"); wait != 0 {
+		t.Fatalf("Attempt() after the delay = %v, want 0", wait)
+	}
+	// A right attempt is taken back and leaves the delay where it was
+	if err := limiter.Succeed(ctx, "account:a"); err != nil {
+		t.Fatalf("Succeed() error = %v", err)
+	}
+	*now = now.Add(time.Second)
+	if wait, _ := limiter.Attempt(ctx, "account:a"); wait != 0 {
+		t.Errorf("Attempt() after a success = %v, want 0", wait)
+	}
+	if wait := waitFor(t, limiter, "account:a"); wait != 2*time.Second {
+		t.Errorf("wait = %v, want 2s", wait)
+	}
+}
+
+func TestLimiter_ConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Attempt(ctx, "account:a")
+			if err != nil {
+				t.Errorf("Attempt() error = %v", err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A burst gets no more guesses than the same guesses made one at a time
+	if allowed != testPolicy.FreeAttempts+1 {
+		t.Errorf("%d parallel attempts got through, want %d", allowed, testPolicy.FreeAttempts+1)
+	}
+	if wait := waitFor(t, limiter, "account:a"); wait != time.Second {
+		t.Errorf("wait = %v, want 1s", wait)
+	}
+}
+
+func TestMemoryStore_Release(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+
+	store.Reserve(ctx, "ip:192.0.2.1", now, testPolicy)
+	store.Reserve(ctx, "ip:192.0.2.1", now, testPolicy)
+	if err := store.Release(ctx, "ip:192.0.2.1"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if record, _ := store.Get(ctx, "ip:192.0.2.1"); record.Failures != 1 {
+		t.Errorf("Failures = %d after a release, want 1", record.Failures)
+	}
+	store.Release(ctx, "ip:192.0.2.1")
+	store.Release(ctx, "ip:192.0.2.1")
+	if _, ok := store.records["ip:192.0.2.1"]; ok {
+		t.Error("record with no failures left was kept")
+	}
+}
+
+// unlimited never makes a key wait, so every Reserve counts
+var unlimited = Policy{FreeAttempts: 1 << 20, Window: time.Hour}
+
+func TestMemoryStore_ConcurrentFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Reserve(ctx, "account:a", now, unlimited)
+		}()
+	}
+	wg.Wait()
+
+	record, err := store.Get(ctx, "account:a")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if record.Failures != 50 {
+		t.Errorf("Failures = %d, want 50", record.Failures)
+	}
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	start := time.Now()
+	policy := Policy{FreeAttempts: sweepEvery, Window: time.Minute}
+	store.Reserve(ctx, "stale", start, policy)
+
+	later := start.Add(time.Hour)
+	for i := 1; i < sweepEvery; i++ {
+		store.Reserve(ctx, "fresh", later, policy)
+	}
+	if _, ok := store.records["stale"]; ok {
+		t.Error("expired record survived a sweep")
+	}
+	if store.records["fresh"].Failures != sweepEvery-1 {
+		t.Errorf("fresh record has %d failures, want %d", store.records["fresh"].Failures, sweepEvery-1)
+	}
+}
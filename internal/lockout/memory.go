@@ -0,0 +1,83 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many recorded failures pass between sweeps of expired records
+const sweepEvery = 1024
+
+// MemoryStore keeps records in process memory. It suits a single server and tests, records are
+// lost on restart and not shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	writes  int
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key string, now time.Time, policy Policy) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record := s.records[key]; policy.Wait(record, now) > 0 {
+		return record, false, nil
+	}
+	return s.recordFailure(key, now, policy.Window), true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	record.Failures--
+	if record.Failures <= 0 {
+		delete(s.records, key)
+		return nil
+	}
+	s.records[key] = record
+	return nil
+}
+
+// recordFailure counts a failure for key, s.mu must be held
+func (s *MemoryStore) recordFailure(key string, now time.Time, window time.Duration) Record {
+	// Keys that stopped failing would otherwise stay forever
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		for k, r := range s.records {
+			if now.Sub(r.LastFailure) > window {
+				delete(s.records, k)
+			}
+		}
+	}
+
+	record := s.records[key]
+	if now.Sub(record.LastFailure) > window {
+		record.Failures = 0
+	}
+	record.Failures++
+	record.LastFailure = now
+	s.records[key] = record
+	return record
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,54 @@
+package lockout
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore keeps records in the login_attempts table, so every server instance shares them
+type PostgresStore struct {
+	Queries *database.Queries
+}
+
+func (s PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	row, err := s.Queries.GetLoginAttempts(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, nil
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, nil
+}
+
+// Reserve checks the policy and counts the attempt in a single conditional upsert, which returns
+// no row when the key has to wait
+func (s PostgresStore) Reserve(ctx context.Context, key string, now time.Time, policy Policy) (Record, bool, error) {
+	row, err := s.Queries.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		Key:          key,
+		Now:          now,
+		WindowStart:  now.Add(-policy.Window),
+		FreeAttempts: int32(policy.FreeAttempts),
+		BaseDelay:    policy.BaseDelay.Seconds(),
+		MaxDelay:     policy.MaxDelay.Seconds(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		record, err := s.Get(ctx, key)
+		return record, false, err
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	return Record{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, true, nil
+}
+
+func (s PostgresStore) Release(ctx context.Context, key string) error {
+	return s.Queries.ReleaseLoginAttempt(ctx, key)
+}
+
+func (s PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.Queries.DeleteLoginAttempts(ctx, key)
+}
@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := &MemoryMailer{}
+	msgs := []Message{
+		{To: "a@example.com", Subject: "first", Body: "one"},
+		{To: "b@example.com", Subject: "second", Body: "two"},
+	}
+	for _, msg := range msgs {
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	got := mailer.Messages()
+	if len(got) != len(msgs) {
+		t.Fatalf("Messages() returned %d messages, want %d", len(got), len(msgs))
+	}
+	for i := range msgs {
+		if got[i] != msgs[i] {
+			t.Errorf("Messages()[%d] = %+v, want %+v", i, got[i], msgs[i])
+		}
+	}
+
+	// The returned slice is a copy
+	got[0].To = "changed@example.com"
+	if mailer.Messages()[0].To != "a@example.com" {
+		t.Error("Messages() exposed the mailer's internal slice")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := mailer.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (err %v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	for _, want := range []string{"To: user@example.com\r\n", "From: chirpy@example.com\r\n", "line one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message is missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		msg     Message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "plain message",
+			msg:  Message{To: "user@example.com", Subject: "Verify", Body: "hi\nthere"},
+			want: []string{
+				"Subject: Verify\r\n",
+				"Date: Fri, 01 Mar 2024 12:00:00 +0000\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n",
+				"\r\n\r\nhi\r\nthere",
+			},
+		},
+		{
+			name: "non ascii subject is encoded",
+			msg:  Message{To: "user@example.com", Subject: "Bienvenue à Chirpy", Body: "x"},
+			want: []string{"Subject: =?utf-8?q?Bienvenue_=C3=A0_Chirpy?=\r\n"},
+		},
+		{
+			name:    "header injection in subject",
+			msg:     Message{To: "user@example.com", Subject: "Hi\r\nBcc: evil@example.com", Body: "x"},
+			wantErr: true,
+		},
+		{
+			name:    "header injection in recipient",
+			msg:     Message{To: "user@example.com\nBcc: evil@example.com", Subject: "Hi", Body: "x"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := formatMessage("chirpy@example.com", tt.msg, date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("formatMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("formatMessage() is missing %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/oidc/oidctest"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testRedirectURL = "https://chirpy.example/api/login/oidc/callback"
+
+func newTestProvider(t *testing.T, secret string) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+	issuer := oidctest.NewIssuer("chirpy", secret)
+	t.Cleanup(issuer.Close)
+	provider, err := Discover(context.Background(), Config{
+		Issuer:       issuer.URL,
+		ClientID:     "chirpy",
+		ClientSecret: secret,
+		RedirectURL:  testRedirectURL,
+	})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	return provider, issuer
+}
+
+// authorize follows AuthCodeURL to the mock issuer and returns the code and state it redirects back with
+func authorize(t *testing.T, provider *Provider, state, nonce, verifier string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(provider.AuthCodeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatalf("authorization request error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization request status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL+"?") {
+		t.Fatalf("redirected to %s, want the redirect URL", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestDiscover(t *testing.T) {
+	issuer := oidctest.NewIssuer("chirpy", "")
+	defer issuer.Close()
+
+	provider, err := Discover(context.Background(), Config{Issuer: issuer.URL, ClientID: "chirpy", RedirectURL: testRedirectURL})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if provider.Issuer() != issuer.URL {
+		t.Errorf("Issuer() = %s, want %s", provider.Issuer(), issuer.URL)
+	}
+
+	// The discovery document names a different issuer than the one configured
+	if _, err := Discover(context.Background(), Config{Issuer: issuer.URL + "/", ClientID: "chirpy", RedirectURL: testRedirectURL}); err == nil {
+		t.Error("Discover() accepted a document for another issuer")
+	}
+	if _, err := Discover(context.Background(), Config{Issuer: issuer.URL, RedirectURL: testRedirectURL}); err == nil {
+		t.Error("Discover() accepted a config without a client ID")
+	}
+}
+
+func TestProvider_AuthCodeURL(t *testing.T) {
+	provider, issuer := newTestProvider(t, "")
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	if !auth.ValidPKCEVerifier(verifier) {
+		t.Fatalf("NewVerifier() = %q, not a valid PKCE verifier", verifier)
+	}
+
+	u, err := url.Parse(provider.AuthCodeURL("the-state", "the-nonce", verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() is not a URL: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != issuer.URL+"/authorize" {
+		t.Errorf("AuthCodeURL() points at %s, want the authorization endpoint", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "chirpy",
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        auth.PKCEChallenge(verifier),
+		"code_challenge_method": "S256",
+	}
+	for param, value := range want {
+		if got := u.Query().Get(param); got != value {
+			t.Errorf("%s = %q, want %q", param, got, value)
+		}
+	}
+	if u.Query().Has("code_verifier") {
+		t.Error("AuthCodeURL() leaked the code verifier")
+	}
+}
+
+func TestProvider_Authenticate(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		provider, issuer := newTestProvider(t, secret)
+		issuer.SetUser(oidctest.User{Subject: "abc", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+		verifier, _ := NewVerifier()
+		code, state := authorize(t, provider, "state-1", "nonce-1", verifier)
+		if state != "state-1" {
+			t.Errorf("state = %q, want it echoed back", state)
+		}
+		idToken, err := provider.Authenticate(context.Background(), code, verifier, "nonce-1")
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if idToken.Issuer != issuer.URL || idToken.Subject != "abc" || idToken.Email != "alice@example.com" || !idToken.EmailVerified || idToken.Name != "Alice" {
+			t.Errorf("Authenticate() = %+v", idToken)
+		}
+
+		// Codes are single use
+		if _, err := provider.Authenticate(context.Background(), code, verifier, "nonce-1"); err == nil {
+			t.Error("Authenticate() accepted a code twice")
+		}
+	}
+}
+
+func TestProvider_AuthenticateRejects(t *testing.T) {
+	provider, _ := newTestProvider(t, "")
+	verifier, _ := NewVerifier()
+	otherVerifier, _ := NewVerifier()
+
+	code, _ := authorize(t, provider, "state", "nonce", verifier)
+	if _, err := provider.Authenticate(context.Background(), code, otherVerifier, "nonce"); err == nil {
+		t.Error("Authenticate() succeeded with the wrong code verifier")
+	}
+
+	code, _ = authorize(t, provider, "state", "nonce", verifier)
+	if _, err := provider.Authenticate(context.Background(), code, verifier, "another-nonce"); err == nil {
+		t.Error("Authenticate() succeeded with the wrong nonce")
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	provider, issuer := newTestProvider(t, "")
+	user := oidctest.User{Subject: "abc", Email: "alice@example.com"}
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		ok     bool
+	}{
+		{name: "valid", modify: func(jwt.MapClaims) {}, ok: true},
+		{name: "email_verified as a string", modify: func(c jwt.MapClaims) { c["email_verified"] = "true" }, ok: true},
+		{name: "several audiences with azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"chirpy", "other"}
+			c["azp"] = "chirpy"
+		}, ok: true},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{name: "several audiences without azp", modify: func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "other"} }},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "wrong nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{name: "missing nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "missing subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.Claims(user, "nonce")
+			tt.modify(claims)
+			idToken, err := provider.Verify(context.Background(), issuer.Sign(claims), "nonce")
+			if tt.ok && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("Verify() accepted an invalid token")
+			}
+			if tt.ok && idToken.Subject != "abc" {
+				t.Errorf("Subject = %q, want abc", idToken.Subject)
+			}
+		})
+	}
+}
+
+func TestProvider_VerifyRejectsUnsignedAlgorithms(t *testing.T) {
+	provider, issuer := newTestProvider(t, "")
+	claims := issuer.Claims(oidctest.User{Subject: "abc"}, "nonce")
+
+	// An HMAC token keyed with something public, and an unsigned one
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("chirpy"))
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	for _, raw := range []string{hmac, none} {
+		if _, err := provider.Verify(context.Background(), raw, "nonce"); err == nil {
+			t.Errorf("Verify() accepted %s", raw)
+		}
+	}
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	provider, issuer := newTestProvider(t, "")
+	user := oidctest.User{Subject: "abc"}
+
+	if _, err := provider.Verify(context.Background(), issuer.Sign(issuer.Claims(user, "nonce")), "nonce"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if issuer.JWKSRequests() != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", issuer.JWKSRequests())
+	}
+	// Cached keys are reused
+	provider.Verify(context.Background(), issuer.Sign(issuer.Claims(user, "nonce")), "nonce")
+	if issuer.JWKSRequests() != 1 {
+		t.Errorf("JWKS fetched %d times, want the cached keys to be used", issuer.JWKSRequests())
+	}
+
+	issuer.RotateKey()
+	rotated := issuer.Sign(issuer.Claims(user, "nonce"))
+
+	// Right after a fetch an unknown kid doesn't trigger another one
+	if _, err := provider.Verify(context.Background(), rotated, "nonce"); err == nil {
+		t.Error("Verify() accepted a token signed with a key it hasn't fetched")
+	}
+	if issuer.JWKSRequests() != 1 {
+		t.Errorf("JWKS fetched %d times within the refresh interval, want 1", issuer.JWKSRequests())
+	}
+
+	provider.keys.fetchedAt = provider.keys.fetchedAt.Add(-minRefreshInterval)
+	if _, err := provider.Verify(context.Background(), rotated, "nonce"); err != nil {
+		t.Errorf("Verify() after the key rotated error = %v", err)
+	}
+	if issuer.JWKSRequests() != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", issuer.JWKSRequests())
+	}
+}
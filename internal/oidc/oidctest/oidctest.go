@@ -0,0 +1,251 @@
+// Package oidctest runs a local OpenID Connect provider for tests. It supports just enough of
+// the protocol for the relying party in package oidc: discovery, a JWKS, an authorization
+// endpoint that signs in a preset user without prompting, and a token endpoint with PKCE.
+package oidctest
+
+import (
+	"chirpy/internal/auth"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User is who the issuer signs in at its authorization endpoint
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type pendingCode struct {
+	user        User
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// Issuer is a running mock provider, stop it with Close
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	server *httptest.Server
+
+	mu           sync.Mutex
+	user         User
+	key          *rsa.PrivateKey
+	kid          string
+	keyCount     int
+	codes        map[string]pendingCode
+	jwksRequests int
+}
+
+// NewIssuer starts an issuer that accepts the given client. An empty secret makes it a public
+// client that identifies itself with client_id in the token request.
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	i := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		user:         User{Subject: "user-1", Email: "user@example.com", EmailVerified: true, Name: "Test User"},
+		codes:        map[string]pendingCode{},
+	}
+	i.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET /jwks", i.jwks)
+	mux.HandleFunc("GET /authorize", i.authorize)
+	mux.HandleFunc("POST /token", i.token)
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+	return i
+}
+
+// Close shuts the issuer down
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// SetUser changes who the authorization endpoint signs in
+func (i *Issuer) SetUser(user User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.user = user
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID
+func (i *Issuer) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: generating key: %v", err))
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keyCount++
+	i.key = key
+	i.kid = fmt.Sprintf("key-%d", i.keyCount)
+}
+
+// JWKSRequests returns how many times the JWKS has been fetched
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+// Claims returns valid ID token claims for user, ready to be changed and passed to Sign
+func (i *Issuer) Claims(user User, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL,
+		"sub":            user.Subject,
+		"aud":            i.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	}
+}
+
+// Sign signs claims with the current key
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	i.mu.Lock()
+	key, kid := i.key, i.kid
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: signing token: %v", err))
+	}
+	return signed
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{auth.PKCEMethodS256},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, req *http.Request) {
+	i.mu.Lock()
+	i.jwksRequests++
+	key, kid := &i.key.PublicKey, i.kid
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the current user in straight away and redirects back with a code
+func (i *Issuer) authorize(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != i.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != auth.PKCEMethodS256 || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	i.mu.Lock()
+	i.codes[code] = pendingCode{
+		user:        i.user,
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, req, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := req.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = req.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID || clientSecret != i.ClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if req.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	i.mu.Lock()
+	pending, ok := i.codes[req.PostForm.Get("code")]
+	delete(i.codes, req.PostForm.Get("code"))
+	i.mu.Unlock()
+	if !ok || pending.redirectURI != req.PostForm.Get("redirect_uri") || !auth.VerifyPKCE(req.PostForm.Get("code_verifier"), pending.challenge) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     i.Sign(i.Claims(pending.user, pending.nonce)),
+	})
+}
+
+func tokenError(w http.ResponseWriter, code int, errCode string) {
+	writeJSON(w, code, map[string]string{"error": errCode})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
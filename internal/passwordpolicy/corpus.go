@@ -0,0 +1,186 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// breachedHashes is the corpus shipped with Chirpy, the most common passwords and their usual variants
+//
+//go:embed breached.txt
+var breachedHashes []byte
+
+// maxCorpusLine bounds a line of a corpus searched on disk, a hash with a count and a CRLF fits easily
+const maxCorpusLine = 128
+
+// Corpus is a set of breached passwords, held as SHA-1 hashes in the format Have I Been Pwned
+// publishes them in. The hashes are either in memory or in a sorted file searched in place.
+type Corpus struct {
+	hashes [][sha1.Size]byte
+
+	file io.ReaderAt
+	size int64
+}
+
+// DefaultCorpus returns the corpus shipped with Chirpy
+func DefaultCorpus() *Corpus {
+	corpus, err := LoadCorpus(bytes.NewReader(breachedHashes))
+	if err != nil {
+		panic(fmt.Sprintf("passwordpolicy: invalid embedded corpus: %v", err))
+	}
+	return corpus
+}
+
+// LoadCorpus reads a corpus of one hex SHA-1 hash per line. A ":count" suffix after the hash, as
+// in the Have I Been Pwned downloads, is ignored, and so are blank lines.
+func LoadCorpus(r io.Reader) (*Corpus, error) {
+	corpus := &Corpus{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		hash, err := parseCorpusLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		corpus.hashes = append(corpus.hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(corpus.hashes, func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return corpus, nil
+}
+
+// OpenCorpus searches a corpus in the format LoadCorpus reads without loading it, for corpora too
+// big for memory such as the full Have I Been Pwned download. The lines must be sorted by hash,
+// as that download is, and there must be no blank lines. Each lookup reads a few dozen lines of r,
+// which must stay readable while the corpus is used.
+func OpenCorpus(r io.ReaderAt, size int64) (*Corpus, error) {
+	corpus := &Corpus{file: r, size: size}
+	// Catch a file in the wrong format now rather than on the first password change
+	if _, err := corpus.lineAt(0); err != nil {
+		return nil, err
+	}
+	return corpus, nil
+}
+
+func parseCorpusLine(text string) ([sha1.Size]byte, error) {
+	text, _, _ = strings.Cut(text, ":")
+	var hash [sha1.Size]byte
+	if n, err := hex.Decode(hash[:], []byte(text)); err != nil || n != sha1.Size {
+		return hash, errors.New("not a SHA-1 hash")
+	}
+	return hash, nil
+}
+
+// Len returns how many passwords the corpus holds, or -1 for a corpus searched on disk
+func (c *Corpus) Len() int {
+	if c.file != nil {
+		return -1
+	}
+	return len(c.hashes)
+}
+
+// Contains reports whether password is in the corpus. A corpus on disk that can't be read
+// reports every password as absent, the breach check is one layer among several.
+func (c *Corpus) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	if c.file != nil {
+		found, err := c.search(hash)
+		return err == nil && found
+	}
+	_, found := slices.BinarySearchFunc(c.hashes, hash, func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return found
+}
+
+// search binary searches the file for the first line starting at or after some offset whose
+// hash is not less than hash, then checks whether that line is hash
+func (c *Corpus) search(hash [sha1.Size]byte) (bool, error) {
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := c.lineStart(mid)
+		if err != nil {
+			return false, err
+		}
+		if start < c.size {
+			line, err := c.lineAt(start)
+			if err != nil {
+				return false, err
+			}
+			if bytes.Compare(line[:], hash[:]) < 0 {
+				lo = mid + 1
+				continue
+			}
+		}
+		hi = mid
+	}
+	start, err := c.lineStart(lo)
+	if err != nil || start >= c.size {
+		return false, err
+	}
+	line, err := c.lineAt(start)
+	return err == nil && line == hash, err
+}
+
+// lineStart returns the offset of the first line starting at or after off, or the file size if
+// there is none
+func (c *Corpus) lineStart(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	buf, err := c.read(off-1, maxCorpusLine)
+	if err != nil {
+		return 0, err
+	}
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		if off-1+int64(len(buf)) >= c.size {
+			return c.size, nil
+		}
+		return 0, fmt.Errorf("offset %d: line too long", off)
+	}
+	return off + int64(i), nil
+}
+
+// lineAt returns the hash on the line starting at off
+func (c *Corpus) lineAt(off int64) ([sha1.Size]byte, error) {
+	buf, err := c.read(off, maxCorpusLine)
+	if err != nil {
+		return [sha1.Size]byte{}, err
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	} else if off+int64(len(buf)) < c.size {
+		return [sha1.Size]byte{}, fmt.Errorf("offset %d: line too long", off)
+	}
+	hash, err := parseCorpusLine(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return hash, fmt.Errorf("offset %d: %w", off, err)
+	}
+	return hash, nil
+}
+
+// read returns up to n bytes of the file from off, fewer at its end
+func (c *Corpus) read(off int64, n int) ([]byte, error) {
+	buf := make([]byte, min(int64(n), c.size-off))
+	if _, err := c.file.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf, nil
+}
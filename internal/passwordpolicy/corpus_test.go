@@ -0,0 +1,77 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCorpus(t *testing.T) {
+	corpus := DefaultCorpus()
+	if corpus.Len() == 0 {
+		t.Fatal("DefaultCorpus() is empty")
+	}
+	for _, password := range []string{"123456", "password", "Password1", "qwerty123", "iloveyou!"} {
+		if !corpus.Contains(password) {
+			t.Errorf("Contains(%q) = false, want true", password)
+		}
+	}
+	if corpus.Contains("gwendolyn-rivers-of-babylon") {
+		t.Error("Contains() = true for a password that was never breached")
+	}
+}
+
+func TestLoadCorpus(t *testing.T) {
+	// SHA-1 of "hunter2" and "letmein", the second in the Have I Been Pwned format
+	input := "F3BBBD66A63D4BF1747940578EC3D0103530E21D\n\nb7a875fc1ea228b9061041b7cec4bd3c52ab3ce3:4521\n"
+	corpus, err := LoadCorpus(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("LoadCorpus() error = %v", err)
+	}
+	if corpus.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", corpus.Len())
+	}
+	if !corpus.Contains("hunter2") || !corpus.Contains("letmein") {
+		t.Error("Contains() = false for a loaded hash")
+	}
+	if corpus.Contains("hunter3") {
+		t.Error("Contains() = true for a password not in the corpus")
+	}
+
+	if _, err := LoadCorpus(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Error("LoadCorpus() accepted a line that isn't a hash")
+	}
+}
+
+func TestOpenCorpus(t *testing.T) {
+	// A sorted file in the Have I Been Pwned format, with CRLF line endings and varying counts
+	var lines []string
+	for i := range 500 {
+		lines = append(lines, fmt.Sprintf("%X:%d", sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))), i*i+1))
+	}
+	slices.Sort(lines)
+	for _, trailer := range []string{"", "\r\n"} {
+		input := strings.Join(lines, "\r\n") + trailer
+		corpus, err := OpenCorpus(strings.NewReader(input), int64(len(input)))
+		if err != nil {
+			t.Fatalf("OpenCorpus() error = %v", err)
+		}
+		if corpus.Len() != -1 {
+			t.Errorf("Len() = %d, want -1", corpus.Len())
+		}
+		for i := range 500 {
+			if password := fmt.Sprintf("breached-%d", i); !corpus.Contains(password) {
+				t.Errorf("Contains(%q) = false, want true", password)
+			}
+			if password := fmt.Sprintf("safe-%d", i); corpus.Contains(password) {
+				t.Errorf("Contains(%q) = true, want false", password)
+			}
+		}
+	}
+
+	if _, err := OpenCorpus(strings.NewReader("not-a-hash\n"), 11); err == nil {
+		t.Error("OpenCorpus() accepted a file that isn't a corpus")
+	}
+}
@@ -0,0 +1,84 @@
+// Package passwordpolicy decides whether a password is good enough to set: long enough, not the
+// account's email, hard enough to guess by a zxcvbn-style estimate, and not in a corpus of
+// passwords known from breaches.
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes identifying why a password was rejected
+const (
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeMatchesEmail = "matches_email"
+	CodeTooWeak      = "too_weak"
+	CodeBreached     = "breached"
+)
+
+// Policy is what a new password has to satisfy
+type Policy struct {
+	// MinLength and MaxLength are in characters, a MaxLength of 0 means no limit
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest Strength score accepted, from 0 (anything) to 4
+	MinScore int
+	// Breached rejects passwords in the corpus, nil skips the check
+	Breached *Corpus
+}
+
+// DefaultPolicy follows NIST SP 800-63B: at least 8 characters, long passphrases allowed,
+// no composition rules, and checked against known breached passwords
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	MaxLength: 256,
+	MinScore:  2,
+	Breached:  DefaultCorpus(),
+}
+
+// Violation is one way a password fails the policy
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Check returns every way password fails the policy, none if it is acceptable. email is the
+// account's address, userInputs are other things about the account, such as its handle, that
+// make a password easier to guess.
+func (p Policy) Check(password, email string, userInputs ...string) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		// Nothing else is worth checking on something this long
+		return append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters", p.MaxLength),
+		})
+	}
+	if email != "" && strings.EqualFold(strings.TrimSpace(password), email) {
+		violations = append(violations, Violation{
+			Code:    CodeMatchesEmail,
+			Message: "Password cannot be your email address",
+		})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "Password has appeared in a data breach, choose another",
+		})
+	} else if Strength(password, append(userInputs, email)...) < p.MinScore {
+		violations = append(violations, Violation{
+			Code:    CodeTooWeak,
+			Message: "Password is too easy to guess, try a longer phrase or fewer common words and patterns",
+		})
+	}
+	return violations
+}
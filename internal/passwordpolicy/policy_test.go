@@ -0,0 +1,52 @@
+package passwordpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []Violation) []string {
+	codes := make([]string, len(violations))
+	for i, v := range violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := DefaultPolicy
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{name: "strong passphrase", password: "kitten-umbrella-42", email: "alice@example.com", want: nil},
+		{name: "empty", password: "", email: "alice@example.com", want: []string{CodeTooShort, CodeTooWeak}},
+		{name: "short", password: "x7#kQ9!", email: "alice@example.com", want: []string{CodeTooShort}},
+		{name: "too long", password: strings.Repeat("x", 257), email: "alice@example.com", want: []string{CodeTooLong}},
+		{name: "breached", password: "Password1", email: "alice@example.com", want: []string{CodeBreached}},
+		{name: "weak", password: "Summer2024!", email: "alice@example.com", want: []string{CodeTooWeak}},
+		{name: "email", password: "Alice.Liddell@example.com", email: "alice.liddell@example.com", want: []string{CodeMatchesEmail, CodeTooWeak}},
+		{name: "multibyte characters count once", password: "ключ-замок-окно", email: "alice@example.com", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationCodes(policy.Check(tt.password, tt.email))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_CheckConfigurable(t *testing.T) {
+	lenient := Policy{MinLength: 4}
+	if violations := lenient.Check("Password1", "alice@example.com"); len(violations) != 0 {
+		t.Errorf("Check() without a corpus or minimum score = %v, want no violations", violations)
+	}
+	strict := Policy{MinLength: 12, MinScore: 4}
+	if got := violationCodes(strict.Check("x7#kQ9!m", "alice@example.com")); strings.Join(got, ",") != CodeTooShort+","+CodeTooWeak {
+		t.Errorf("Check() = %v, want too short and too weak", got)
+	}
+}
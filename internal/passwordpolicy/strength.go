@@ -0,0 +1,292 @@
+package passwordpolicy
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonText lists common passwords and words, most common first
+//
+//go:embed common.txt
+var commonText string
+
+// commonRanks maps each common password to its rank, 1 being the most common
+var commonRanks, maxCommonLength = func() (map[string]int, int) {
+	ranks := map[string]int{}
+	longest := 0
+	for i, word := range strings.Fields(commonText) {
+		ranks[word] = i + 1
+		longest = max(longest, utf8.RuneCountInString(word))
+	}
+	return ranks, longest
+}()
+
+// keyboardRows are walked as spatial patterns like "qwerty" or "4321"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetSubstitutions undoes the usual character swaps, p@ssw0rd is still password
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+const (
+	// bruteforceGuesses is what each character no pattern explains adds, as in zxcvbn
+	bruteforceGuesses = 10
+	// minPatternGuesses keeps a match from counting for less than a few random characters
+	minPatternGuesses = 50
+	// yearGuesses covers the years people put in passwords
+	yearGuesses = 150
+)
+
+// Strength scores how hard password is to guess from 0 (trivially) to 4 (very hard), with the
+// zxcvbn thresholds: the number of guesses an attacker needs is estimated by splitting the
+// password into the cheapest sequence of common words, repeats, sequences, keyboard walks, years
+// and random characters. userInputs, such as the email and handle, count as the most common words.
+func Strength(password string, userInputs ...string) int {
+	guesses := log10Guesses(password, userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// match is a pattern covering runes [start, end) of the password
+type match struct {
+	start, end int
+	guesses    float64
+}
+
+// log10Guesses returns the log10 of the guesses for the cheapest way to build password
+func log10Guesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	endingAt := make([][]match, len(runes)+1)
+	for _, m := range findMatches(runes, lower, userInputs) {
+		endingAt[m.end] = append(endingAt[m.end], m)
+	}
+
+	// best[i] is the cheapest (log10) way to guess the first i runes
+	best := make([]float64, len(runes)+1)
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] + math.Log10(bruteforceGuesses)
+		for _, m := range endingAt[i] {
+			best[i] = min(best[i], best[m.start]+math.Log10(max(m.guesses, minPatternGuesses)))
+		}
+	}
+	return best[len(runes)]
+}
+
+func findMatches(runes, lower []rune, userInputs []string) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, lower, userTokens(userInputs))...)
+	matches = append(matches, repeatMatches(lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, yearMatches(lower)...)
+	return matches
+}
+
+// userTokens splits the user inputs into the words someone might build a password from
+func userTokens(userInputs []string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		words := strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range append(words, input) {
+			if utf8.RuneCountInString(word) >= 3 {
+				tokens[word] = true
+			}
+		}
+	}
+	return tokens
+}
+
+func dictionaryMatches(runes, lower []rune, tokens map[string]bool) []match {
+	maxLength := maxCommonLength
+	for token := range tokens {
+		maxLength = max(maxLength, utf8.RuneCountInString(token))
+	}
+
+	var matches []match
+	for i := range lower {
+		for j := i + 3; j <= len(lower) && j-i <= maxLength; j++ {
+			word := string(lower[i:j])
+			variations := uppercaseVariations(runes[i:j])
+			rank, ok := wordRank(word, tokens)
+			if unleeted := unleet(lower[i:j]); !ok && unleeted != word {
+				rank, ok = wordRank(unleeted, tokens)
+				variations *= 2
+			}
+			if ok {
+				matches = append(matches, match{start: i, end: j, guesses: float64(rank) * variations})
+			}
+		}
+	}
+	return matches
+}
+
+func wordRank(word string, tokens map[string]bool) (int, bool) {
+	if tokens[word] {
+		return 1, true
+	}
+	rank, ok := commonRanks[word]
+	return rank, ok
+}
+
+func unleet(word []rune) string {
+	out := make([]rune, len(word))
+	for i, r := range word {
+		if sub, ok := leetSubstitutions[r]; ok {
+			r = sub
+		}
+		out[i] = r
+	}
+	return string(out)
+}
+
+// uppercaseVariations is how many capitalisations of a word an attacker tries before this one
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]), upper == 1 && unicode.IsUpper(word[len(word)-1]):
+		return 2
+	}
+	return math.Pow(2, float64(min(upper, len(word)-upper)))
+}
+
+// repeatMatches finds runs of one character, like "aaaa"
+func repeatMatches(lower []rune) []match {
+	var matches []match
+	for i := 0; i < len(lower); {
+		j := i + 1
+		for j < len(lower) && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			matches = append(matches, match{start: i, end: j, guesses: cardinality(lower[i]) * float64(j-i)})
+		}
+		i = j
+	}
+	return matches
+}
+
+// sequenceMatches finds runs of consecutive letters or digits, like "abcd" or "9876"
+func sequenceMatches(lower []rune) []match {
+	var matches []match
+	for i := 0; i < len(lower)-2; {
+		delta := lower[i+1] - lower[i]
+		if (delta != 1 && delta != -1) || !sameClass(lower[i], lower[i+1]) {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < len(lower) && lower[j]-lower[j-1] == delta && sameClass(lower[j-1], lower[j]) {
+			j++
+		}
+		if j-i >= 3 {
+			base := cardinality(lower[i])
+			// Starting from either end of the alphabet or digits is the first thing tried
+			if strings.ContainsRune("az09", lower[i]) || lower[i] == '1' {
+				base = 4
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{start: i, end: j, guesses: base * float64(j-i)})
+		}
+		i = j - 1
+	}
+	return matches
+}
+
+// keyboardMatches finds walks of four or more keys along a keyboard row, either way
+func keyboardMatches(lower []rune) []match {
+	var matches []match
+	for _, row := range keyboardRows {
+		for _, walk := range []string{row, reverse(row)} {
+			for i := 0; i < len(lower); {
+				k := strings.IndexRune(walk, lower[i])
+				if k < 0 {
+					i++
+					continue
+				}
+				j := i + 1
+				for j < len(lower) && k+j-i < len(walk) && rune(walk[k+j-i]) == lower[j] {
+					j++
+				}
+				if j-i >= 4 {
+					matches = append(matches, match{start: i, end: j, guesses: 20 * float64(j-i)})
+				}
+				i = j
+			}
+		}
+	}
+	return matches
+}
+
+// yearMatches finds four digit years from 1900 to 2049
+func yearMatches(lower []rune) []match {
+	var matches []match
+	for i := 0; i+4 <= len(lower); i++ {
+		s := string(lower[i : i+4])
+		if (strings.HasPrefix(s, "19") || s >= "2000" && s <= "2049") && isDigits(s) {
+			matches = append(matches, match{start: i, end: i + 4, guesses: yearGuesses})
+		}
+	}
+	return matches
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z':
+		return 26
+	}
+	return 33
+}
+
+func sameClass(a, b rune) bool {
+	return cardinality(a) == cardinality(b) && cardinality(a) != 33
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
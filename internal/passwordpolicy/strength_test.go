@@ -0,0 +1,56 @@
+package passwordpolicy
+
+import "testing"
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{password: "", want: 0},
+		{password: "password", want: 0},
+		{password: "p@ssw0rd", want: 0},
+		{password: "aaaaaaaaaaaaaaaa", want: 0},
+		{password: "abcdefghijkl", want: 0},
+		{password: "Password1!", want: 0},
+		{password: "qwertyuiop123", want: 1},
+		{password: "asdfqwer", want: 1},
+		{password: "iloveyou2024", want: 1},
+		{password: "x7#kQ9!m", want: 3},
+		{password: "Tr0ub4dor&3", want: 4},
+		{password: "correct horse battery staple", want: 4},
+	}
+	for _, tt := range tests {
+		if got := Strength(tt.password); got != tt.want {
+			t.Errorf("Strength(%q) = %d, want %d", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestStrength_UserInputs(t *testing.T) {
+	password := "gwendolyn-rivers"
+	if got := Strength(password); got != 4 {
+		t.Fatalf("Strength(%q) = %d, want 4", password, got)
+	}
+	if got := Strength(password, "gwendolyn@example.com", "rivers"); got > 1 {
+		t.Errorf("Strength(%q) with the user's own name = %d, want at most 1", password, got)
+	}
+}
+
+func TestUppercaseVariations(t *testing.T) {
+	tests := []struct {
+		word string
+		want float64
+	}{
+		{word: "password", want: 1},
+		{word: "Password", want: 2},
+		{word: "PASSWORD", want: 2},
+		{word: "passworD", want: 2},
+		{word: "PaSsword", want: 4},
+	}
+	for _, tt := range tests {
+		if got := uppercaseVariations([]rune(tt.word)); got != tt.want {
+			t.Errorf("uppercaseVariations(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,23 @@ package main
 
 import (
 	"chirpy/internal/api"
+	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"chirpy/internal/lockout"
+	"chirpy/internal/mail"
+	"chirpy/internal/oidc"
+	"chirpy/internal/passwordpolicy"
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -17,14 +30,40 @@ func main() {
 	platformType := os.Getenv("PLATFORM")
 	bearerTokenSecret := os.Getenv("BEARER_TOKEN_SECRET")
 	apiKey := os.Getenv("POLKA_KEY")
+	requireEmailVerification := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if err := createAdmin(dbURL, passwordPolicy, os.Args[2:]); err != nil {
+			log.Fatalf("Error creating admin: %v", err)
+		}
+		return
+	}
+	if err := loadPasswordParams(); err != nil {
+		log.Fatalf("Error loading password hashing params: %v", err)
+	}
+	jwtKeys, err := loadJWTKeys(bearerTokenSecret)
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
 	db, _ := sql.Open("postgres", dbURL)
 	dbQueries := database.New(db)
+	lockoutStore := newLockoutStore(dbQueries)
 
 	cfg := api.Config{
-		DbQueries:   dbQueries,
-		Platform:    platformType,
-		BearerToken: bearerTokenSecret,
-		APIKey:      apiKey,
+		DB:                       db,
+		DbQueries:                dbQueries,
+		Platform:                 platformType,
+		JWTKeys:                  jwtKeys,
+		APIKey:                   apiKey,
+		Mailer:                   newMailer(),
+		RequireEmailVerification: requireEmailVerification,
+		AccountLimiter:           lockout.NewLimiter(lockoutStore, accountLockoutPolicy),
+		IPLimiter:                lockout.NewLimiter(lockoutStore, ipLockoutPolicy),
+		OIDC:                     newOIDCProvider(),
+		PasswordPolicy:           passwordPolicy,
 	}
 	mux := http.NewServeMux()
 	mux.Handle(
@@ -36,21 +75,291 @@ func main() {
 			),
 		),
 	)
-	mux.HandleFunc("GET /admin/metrics", cfg.DisplayMetrics)
-	mux.HandleFunc("POST /admin/reset", cfg.ResetDatabase)
+	mux.HandleFunc("GET /admin/metrics", cfg.RequirePermission(api.PermViewMetrics, cfg.DisplayMetrics))
+	mux.HandleFunc("POST /admin/reset", cfg.RequirePermission(api.PermResetDatabase, cfg.ResetDatabase))
+	mux.HandleFunc("PUT /admin/users/{id}/role", cfg.RequirePermission(api.PermManageRoles, cfg.SetUserRole))
+	mux.HandleFunc("DELETE /admin/users/{id}/lockout", cfg.RequirePermission(api.PermUnlockAccounts, cfg.UnlockUser))
 	mux.HandleFunc("GET /admin/healthz", api.HandleOKRequest)
-	mux.HandleFunc("POST /api/chirps", cfg.CreateChirp)
-	mux.HandleFunc("GET /api/chirps", cfg.GetChirps)
-	mux.HandleFunc("GET /api/chirps/{id}", cfg.GetChirpByID)
-	mux.HandleFunc("DELETE /api/chirps/{id}", cfg.DeleteChirpByID)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.GetJWKS)
+	mux.HandleFunc("POST /api/chirps", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.CreateChirp))
+	mux.HandleFunc("GET /api/chirps", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.GetChirps))
+	mux.HandleFunc("GET /api/chirps/{id}", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.GetChirpByID))
+	mux.HandleFunc("GET /api/chirps/{id}/thread", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.GetChirpThread))
+	mux.HandleFunc("PUT /api/chirps/{id}", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.UpdateChirp))
+	mux.HandleFunc("GET /api/chirps/{id}/revisions", cfg.GetChirpRevisions)
+	mux.HandleFunc("DELETE /api/chirps/{id}", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.DeleteChirpByID))
+	mux.HandleFunc("POST /api/chirps/{id}/like", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.LikeChirp))
+	mux.HandleFunc("DELETE /api/chirps/{id}/like", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.UnlikeChirp))
+	mux.HandleFunc("POST /api/chirps/{id}/rechirp", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.Rechirp))
+	mux.HandleFunc("DELETE /api/chirps/{id}/rechirp", cfg.RequireAuth(api.ScopeChirpsWrite, cfg.UndoRechirp))
 	mux.HandleFunc("POST /api/users", cfg.RegisterUser)
-	mux.HandleFunc("PUT /api/users", cfg.UpdateUser)
+	mux.HandleFunc("PUT /api/users", cfg.RequireAuth(api.ScopeAccount, cfg.UpdateUser))
+	mux.HandleFunc("PATCH /api/users", cfg.RequireAuth(api.ScopeProfileWrite, cfg.PatchUser))
+	mux.HandleFunc("DELETE /api/users", cfg.RequireAuth(api.ScopeAccount, cfg.DeleteUser))
+	mux.HandleFunc("DELETE /api/users/deletion", cfg.RequireAuth(api.ScopeAccount, cfg.CancelUserDeletion))
+	mux.HandleFunc("GET /api/users/me/export", cfg.RequireAuth(api.ScopeAccount, cfg.ExportUserData))
+	mux.HandleFunc("POST /api/users/email/verify", cfg.VerifyEmailChange)
+	mux.HandleFunc("POST /api/users/verify", cfg.VerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", cfg.RequireAuth(api.ScopeAccount, cfg.ResendEmailVerification))
+	mux.HandleFunc("POST /api/users/2fa/setup", cfg.RequireAuth(api.ScopeAccount, cfg.SetupTwoFactor))
+	mux.HandleFunc("POST /api/users/2fa/confirm", cfg.RequireAuth(api.ScopeAccount, cfg.ConfirmTwoFactor))
+	mux.HandleFunc("DELETE /api/users/2fa", cfg.RequireAuth(api.ScopeAccount, cfg.DisableTwoFactor))
+	mux.HandleFunc("GET /api/users/{handle}", cfg.GetUserProfile)
+	mux.HandleFunc("POST /api/users/{id}/follow", cfg.RequireAuth(api.ScopeFollowsWrite, cfg.FollowUser))
+	mux.HandleFunc("DELETE /api/users/{id}/follow", cfg.RequireAuth(api.ScopeFollowsWrite, cfg.UnfollowUser))
+	mux.HandleFunc("GET /api/users/{id}/followers", cfg.GetFollowers)
+	mux.HandleFunc("GET /api/users/{id}/following", cfg.GetFollowing)
+	mux.HandleFunc("GET /api/users/{id}/mentions", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.GetUserMentions))
+	mux.HandleFunc("GET /api/timeline", cfg.RequireAuth(api.ScopeChirpsRead, cfg.GetTimeline))
+	mux.HandleFunc("GET /api/search/chirps", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.SearchChirps))
+	mux.HandleFunc("GET /api/hashtags/trending", cfg.GetTrendingHashtags)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.OptionalAuth(api.ScopeChirpsRead, cfg.GetHashtagChirps))
 	mux.HandleFunc("POST /api/login", cfg.LoginUser)
+	mux.HandleFunc("POST /api/login/2fa", cfg.LoginTwoFactor)
+	mux.HandleFunc("GET /api/login/oidc", cfg.LoginOIDC)
+	mux.HandleFunc("GET /api/login/oidc/callback", cfg.LoginOIDCCallback)
 	mux.HandleFunc("POST /api/refresh", cfg.RefreshTokenHandler)
 	mux.HandleFunc("POST /api/revoke", cfg.RevokeRefreshToken)
+	mux.HandleFunc("POST /api/tokens", cfg.RequireAuth(api.ScopeAccount, cfg.CreatePersonalAccessToken))
+	mux.HandleFunc("GET /api/tokens", cfg.RequireAuth(api.ScopeAccount, cfg.ListPersonalAccessTokens))
+	mux.HandleFunc("DELETE /api/tokens/{id}", cfg.RequireAuth(api.ScopeAccount, cfg.DeletePersonalAccessToken))
+	mux.HandleFunc("GET /api/sessions", cfg.RequireAuth(api.ScopeAccount, cfg.ListSessions))
+	mux.HandleFunc("DELETE /api/sessions/{id}", cfg.RequireAuth(api.ScopeAccount, cfg.RevokeSession))
+	mux.HandleFunc("POST /api/sessions/revoke-all", cfg.RequireAuth(api.ScopeAccount, cfg.RevokeOtherSessions))
+	mux.HandleFunc("POST /api/oauth/clients", cfg.RequireAuth(api.ScopeAccount, cfg.RegisterOAuthClient))
+	mux.HandleFunc("GET /api/oauth/clients", cfg.RequireAuth(api.ScopeAccount, cfg.ListOAuthClients))
+	mux.HandleFunc("DELETE /api/oauth/clients/{id}", cfg.RequireAuth(api.ScopeAccount, cfg.DeleteOAuthClient))
+	mux.HandleFunc("GET /oauth/authorize", cfg.OAuthAuthorizePage)
+	mux.HandleFunc("POST /oauth/authorize", cfg.OAuthAuthorize)
+	mux.HandleFunc("POST /oauth/token", cfg.OAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", cfg.OAuthRevoke)
+	mux.HandleFunc("POST /oauth/introspect", cfg.OAuthIntrospect)
+	mux.HandleFunc("POST /api/password/forgot", cfg.ForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", cfg.ResetPassword)
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.ChirpyRedWebhook)
+	go cfg.PurgeDeletedAccounts(context.Background(), accountPurgeInterval)
 	server := http.Server{Addr: ":8080", Handler: mux}
 	if err := server.ListenAndServe(); err != nil {
 		return
 	}
 }
+
+// createAdmin runs the create-admin command, which gives the account for -email the admin role.
+// A missing account is created with the password from ADMIN_PASSWORD.
+func createAdmin(dbURL string, passwordPolicy passwordpolicy.Policy, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the admin account")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("usage: chirpy create-admin -email <address>")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	cfg := api.Config{DB: db, DbQueries: database.New(db), PasswordPolicy: passwordPolicy}
+	user, err := cfg.CreateAdmin(context.Background(), *email, os.Getenv("ADMIN_PASSWORD"))
+	if err != nil {
+		return err
+	}
+	log.Printf("%s (%s) is now an admin", user.Email, user.ID)
+	return nil
+}
+
+// loadPasswordParams sets the argon2id costs new password hashes use from PASSWORD_ARGON2_MEMORY
+// (KiB), PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM, each defaulting to the
+// library defaults. Raising them upgrades existing hashes as their users log in.
+func loadPasswordParams() error {
+	params := auth.DefaultPasswordParams
+	for _, setting := range []struct {
+		env  string
+		bits int
+		set  func(uint64)
+	}{
+		{"PASSWORD_ARGON2_MEMORY", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"PASSWORD_ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"PASSWORD_ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	} {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", setting.env, err)
+		}
+		setting.set(v)
+	}
+	return auth.SetPasswordParams(params)
+}
+
+// loadPasswordPolicy starts from the default policy, with PASSWORD_MIN_LENGTH and PASSWORD_MIN_SCORE
+// (0 to 4) overriding its minimums and BREACHED_PASSWORDS_FILE replacing the shipped corpus with a
+// larger one, such as a download from Have I Been Pwned
+func loadPasswordPolicy() (passwordpolicy.Policy, error) {
+	policy := passwordpolicy.DefaultPolicy
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		minLength, err := strconv.Atoi(value)
+		if err != nil || minLength < 1 || minLength > policy.MaxLength {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", value)
+		}
+		policy.MinLength = minLength
+	}
+	if value := os.Getenv("PASSWORD_MIN_SCORE"); value != "" {
+		minScore, err := strconv.Atoi(value)
+		if err != nil || minScore < 0 || minScore > 4 {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_SCORE %q", value)
+		}
+		policy.MinScore = minScore
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		corpus, err := openBreachedCorpus(path)
+		if err != nil {
+			return policy, fmt.Errorf("%s: %w", path, err)
+		}
+		policy.Breached = corpus
+	}
+	return policy, nil
+}
+
+// maxCorpusInMemory is the largest breached password file loaded into memory, bigger ones are
+// searched on disk
+const maxCorpusInMemory = 64 << 20
+
+// openBreachedCorpus loads a small corpus in whatever order it comes in. A larger one, like the
+// tens of gigabytes of the full Have I Been Pwned download, stays on disk and has to be sorted by
+// hash, so the file is left open for the life of the process.
+func openBreachedCorpus(path string) (*passwordpolicy.Corpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() > maxCorpusInMemory {
+		corpus, err := passwordpolicy.OpenCorpus(f, info.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		log.Printf("Searching breached password hashes in %s on disk", path)
+		return corpus, nil
+	}
+	defer f.Close()
+	corpus, err := passwordpolicy.LoadCorpus(f)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d breached password hashes from %s", corpus.Len(), path)
+	return corpus, nil
+}
+
+// Failed logins per account back off after 5 tries and lock for up to 15 minutes. Client IPs get
+// more room since one address can front many users behind NAT.
+var (
+	accountLockoutPolicy = lockout.Policy{FreeAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	ipLockoutPolicy      = lockout.Policy{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+)
+
+// accountPurgeInterval is how often accounts past their deletion grace period are purged
+const accountPurgeInterval = time.Hour
+
+// newLockoutStore picks where failed logins are counted from LOCKOUT_STORE: "memory" for a single
+// instance, or the default of Postgres so every instance shares the counts
+func newLockoutStore(q *database.Queries) lockout.Store {
+	if os.Getenv("LOCKOUT_STORE") == "memory" {
+		return lockout.NewMemoryStore()
+	}
+	return lockout.PostgresStore{Queries: q}
+}
+
+// newOIDCProvider discovers the single sign-on provider from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL. Without an issuer, or if discovery fails, sign-in
+// with the provider is turned off and password logins carry on working.
+func newOIDCProvider() *oidc.Provider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	})
+	if err != nil {
+		log.Printf("Single sign-on disabled: %v", err)
+		return nil
+	}
+	return provider
+}
+
+// newMailer picks how email is delivered from MAILER: "smtp", "file" or the default of logging messages
+func newMailer() mail.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return mail.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		return mail.FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+	default:
+		return mail.LogMailer{}
+	}
+}
+
+// loadJWTKeys builds the keyring tokens are signed and verified with. JWT_SIGNING_KEY_FILE names a
+// PEM Ed25519 or RSA private key to sign with, otherwise tokens are signed with the HMAC secret.
+// JWT_VERIFY_KEY_FILES is a comma separated list of retired PEM keys whose tokens are still accepted.
+// While the HMAC secret is set it also stays accepted, so moving to a key file logs nobody out.
+func loadJWTKeys(secret string) (*auth.Keyring, error) {
+	var keys []*auth.SigningKey
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if secret != "" {
+		keys = append(keys, auth.NewHMACKey([]byte(secret)))
+	}
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("set BEARER_TOKEN_SECRET or JWT_SIGNING_KEY_FILE")
+	}
+	return auth.NewKeyring(keys[0], keys[1:]...)
+}
+
+func readPEMKey(path string) (*auth.SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return auth.ParsePEMKey(data)
+}
@@ -1,6 +1,6 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, root_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: RemoveAllChirps :exec
@@ -10,10 +10,94 @@ DELETE FROM chirps;
 DELETE FROM chirps
 WHERE id = $1;
 
+-- name: TombstoneChirpByID :exec
+UPDATE chirps
+SET body = '', deleted_at = $2, updated_at = $2
+WHERE id = $1;
+
+-- name: CountChirpReplies :one
+SELECT count(*) FROM chirps
+WHERE parent_id = $1;
+
 -- name: GetChirps :many
 SELECT * FROM chirps
 ORDER BY created_at;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetChirpsPageAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (created_at, id) > (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetChirpsPageDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (created_at, id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetTimelinePage :many
+SELECT c.*, t.activity_at, t.rechirped_by
+FROM (
+    SELECT DISTINCT ON (a.chirp_id) a.chirp_id, a.activity_at, a.rechirped_by
+    FROM (
+        SELECT id AS chirp_id, created_at AS activity_at, NULL::uuid AS rechirped_by
+        FROM chirps
+        WHERE user_id = sqlc.arg('user_id')
+           OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+        UNION ALL
+        SELECT chirp_id, created_at, user_id
+        FROM rechirps
+        WHERE user_id = sqlc.arg('user_id')
+           OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+    ) a
+    ORDER BY a.chirp_id, a.activity_at DESC, a.rechirped_by NULLS FIRST
+) t
+JOIN chirps c ON c.id = t.chirp_id
+WHERE c.deleted_at IS NULL
+  AND (t.activity_at, c.id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY t.activity_at DESC, c.id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetThreadChirps :many
+SELECT * FROM chirps
+WHERE id = sqlc.arg('root_id') OR root_id = sqlc.arg('root_id')
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: GetChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC, id DESC;
+
+-- name: GetUserChirps :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: GetUserChirpRevisions :many
+SELECT chirp_revisions.* FROM chirp_revisions
+JOIN chirps ON chirps.id = chirp_revisions.chirp_id
+WHERE chirps.user_id = $1
+ORDER BY chirp_revisions.replaced_at, chirp_revisions.id;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- name: CreateEmailChangeToken :one
+INSERT INTO email_change_tokens (token_hash, user_id, new_email, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: DeletePendingEmailChangeTokens :exec
+DELETE FROM email_change_tokens
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseEmailChangeToken :one
+UPDATE email_change_tokens
+SET used_at = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (id, user_id, created_at, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = $2
+WHERE id = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: DeletePendingEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1 AND used_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- name: CreateFollow :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveFollow :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowersPage :many
+SELECT f.follower_id AS user_id, f.created_at, u.handle, u.display_name
+FROM follows f
+JOIN users u ON u.id = f.follower_id
+WHERE f.followee_id = sqlc.arg('user_id')
+  AND (f.created_at, f.follower_id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY f.created_at DESC, f.follower_id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetFollowingPage :many
+SELECT f.followee_id AS user_id, f.created_at, u.handle, u.display_name
+FROM follows f
+JOIN users u ON u.id = f.followee_id
+WHERE f.follower_id = sqlc.arg('user_id')
+  AND (f.created_at, f.followee_id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY f.created_at DESC, f.followee_id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetUserFollows :many
+SELECT * FROM follows
+WHERE follower_id = $1
+ORDER BY created_at;
\ No newline at end of file
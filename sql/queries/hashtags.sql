@@ -0,0 +1,33 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (id, tag, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+RETURNING *;
+
+-- name: AddChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetHashtagChirpsPage :many
+SELECT c.* FROM chirps c
+JOIN chirp_hashtags ch ON ch.chirp_id = c.id
+JOIN hashtags h ON h.id = ch.hashtag_id
+WHERE h.tag = sqlc.arg('tag')
+  AND c.deleted_at IS NULL
+  AND (c.created_at, c.id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetTrendingHashtags :many
+SELECT h.tag, count(*) AS chirp_count
+FROM chirp_hashtags ch
+JOIN hashtags h ON h.id = ch.hashtag_id
+WHERE ch.created_at >= sqlc.arg('since')::timestamp
+GROUP BY h.tag
+ORDER BY chirp_count DESC, h.tag ASC
+LIMIT sqlc.arg('page_size');
\ No newline at end of file
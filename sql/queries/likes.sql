@@ -0,0 +1,65 @@
+-- name: LikeChirp :exec
+WITH inserted AS (
+    INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+    VALUES ($1, $2, $3)
+    ON CONFLICT DO NOTHING
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = like_count + 1
+WHERE id = (SELECT chirp_id FROM inserted);
+
+-- name: UnlikeChirp :exec
+WITH deleted AS (
+    DELETE FROM chirp_likes
+    WHERE user_id = $1 AND chirp_id = $2
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET like_count = like_count - 1
+WHERE id = (SELECT chirp_id FROM deleted);
+
+-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id') AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: CreateRechirp :exec
+WITH inserted AS (
+    INSERT INTO rechirps (user_id, chirp_id, created_at)
+    VALUES ($1, $2, $3)
+    ON CONFLICT DO NOTHING
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET rechirp_count = rechirp_count + 1
+WHERE id = (SELECT chirp_id FROM inserted);
+
+-- name: RemoveRechirp :exec
+WITH deleted AS (
+    DELETE FROM rechirps
+    WHERE user_id = $1 AND chirp_id = $2
+    RETURNING chirp_id
+)
+UPDATE chirps
+SET rechirp_count = rechirp_count - 1
+WHERE id = (SELECT chirp_id FROM deleted);
+
+-- name: UncountUserLikes :exec
+UPDATE chirps
+SET like_count = like_count - 1
+WHERE id IN (SELECT chirp_id FROM chirp_likes WHERE user_id = $1);
+
+-- name: UncountUserRechirps :exec
+UPDATE chirps
+SET rechirp_count = rechirp_count - 1
+WHERE id IN (SELECT chirp_id FROM rechirps WHERE user_id = $1);
+
+-- name: GetUserLikes :many
+SELECT * FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetUserRechirps :many
+SELECT * FROM rechirps
+WHERE user_id = $1
+ORDER BY created_at;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- name: GetLoginAttempts :one
+SELECT * FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: ReserveLoginAttempt :one
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES (sqlc.arg('key'), 1, sqlc.arg('now'))
+ON CONFLICT (key) DO UPDATE
+-- failures older than the window are forgotten and counting starts over
+SET failures = CASE WHEN login_attempts.last_failure_at < sqlc.arg('window_start')::timestamp THEN 1 ELSE login_attempts.failures + 1 END,
+    last_failure_at = EXCLUDED.last_failure_at
+-- the attempt is only counted once the delay since the last failure has passed, mirroring lockout.Policy.Delay
+WHERE login_attempts.last_failure_at < sqlc.arg('window_start')::timestamp
+    OR login_attempts.failures <= sqlc.arg('free_attempts')::integer
+    OR login_attempts.last_failure_at + make_interval(secs => least(
+        sqlc.arg('base_delay')::float8 * power(2, least(login_attempts.failures - sqlc.arg('free_attempts')::integer - 1, 62)),
+        sqlc.arg('max_delay')::float8
+    )) <= sqlc.arg('now')
+RETURNING *;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_attempts
+SET failures = failures - 1
+WHERE key = $1 AND failures > 0;
\ No newline at end of file
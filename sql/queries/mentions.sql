@@ -0,0 +1,30 @@
+-- name: GetUsersByHandles :many
+SELECT id, handle FROM users
+WHERE lower(handle) = ANY(sqlc.arg('handles')::text[]);
+
+-- name: AddChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT m.chirp_id, m.user_id, m.start_offset, m.end_offset, u.handle
+FROM chirp_mentions m
+JOIN users u ON u.id = m.user_id
+WHERE m.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY m.chirp_id, m.start_offset;
+
+-- name: GetMentioningChirpsPage :many
+SELECT * FROM chirps c
+WHERE EXISTS (
+    SELECT 1 FROM chirp_mentions m
+    WHERE m.chirp_id = c.id AND m.user_id = sqlc.arg('user_id')
+)
+  AND c.deleted_at IS NULL
+  AND (c.created_at, c.id) < (sqlc.arg('cursor_created_at')::timestamp, sqlc.arg('cursor_id')::uuid)
+ORDER BY c.created_at DESC, c.id DESC
+LIMIT sqlc.arg('page_size');
\ No newline at end of file
@@ -0,0 +1,77 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetUserOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: UseOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = $2
+WHERE code_hash = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: GetOAuthAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1;
+
+-- name: SetOAuthAuthorizationCodeGrant :exec
+UPDATE oauth_authorization_codes
+SET grant_id = $2
+WHERE code_hash = $1;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, client_id, user_id, scopes, refresh_token_hash, created_at, refresh_expires_at, last_used_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants
+WHERE id = $1;
+
+-- name: GetOAuthGrantByRefreshToken :one
+SELECT * FROM oauth_grants
+WHERE refresh_token_hash = $1;
+
+-- name: RotateOAuthRefreshToken :execrows
+UPDATE oauth_grants
+SET refresh_token_hash = sqlc.arg('new_refresh_token_hash'), refresh_expires_at = sqlc.arg('refresh_expires_at'), last_used_at = sqlc.arg('last_used_at')
+WHERE id = sqlc.arg('id') AND refresh_token_hash = sqlc.arg('refresh_token_hash') AND revoked_at IS NULL;
+
+-- name: RetireOAuthRefreshToken :exec
+INSERT INTO oauth_retired_refresh_tokens (token_hash, grant_id, retired_at)
+VALUES ($1, $2, $3);
+
+-- name: GetRetiredOAuthRefreshToken :one
+SELECT * FROM oauth_retired_refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants
+SET revoked_at = $2
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: GetUserOAuthGrants :many
+SELECT * FROM oauth_grants
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: RevokeUserOAuthGrants :exec
+UPDATE oauth_grants
+SET revoked_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL;
\ No newline at end of file
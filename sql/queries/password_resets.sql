@@ -0,0 +1,18 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: DeletePendingPasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING *;
+
+-- name: CountRecentPasswordResetTokens :one
+SELECT count(*) FROM password_reset_tokens
+WHERE user_id = sqlc.arg('user_id') AND used_at IS NULL AND created_at > sqlc.arg('since');
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, root_id, deleted_at, like_count, rechirp_count, rank
+FROM (
+    SELECT chirps.*, ts_rank_cd(search_vector, query) AS rank
+    FROM chirps, to_tsquery('english', sqlc.arg('query')) query
+    WHERE search_vector @@ query
+      AND deleted_at IS NULL
+      AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+) ranked
+WHERE (rank, id) < (sqlc.arg('cursor_rank')::real, sqlc.arg('cursor_id')::uuid)
+ORDER BY rank DESC, id DESC
+LIMIT sqlc.arg('page_size');
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (id, user_id, event_type, details, ip_address, created_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetUserSecurityEvents :many
+SELECT * FROM security_events
+WHERE user_id = $1
+ORDER BY created_at;
\ No newline at end of file
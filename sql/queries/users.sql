@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
 -- name: RemoveAllUsers :exec
@@ -16,5 +16,68 @@ WHERE id = $1;
 
 -- name: UpdateUser :exec
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = $4
+SET email = $2, hashed_password = $3, updated_at = $4, handle = $5, display_name = $6, bio = $7, avatar_url = $8,
+    -- a different address has to be verified again
+    email_verified_at = CASE WHEN users.email = $2 THEN users.email_verified_at END
+WHERE id = $1;
+
+-- name: SetUserEmailVerified :exec
+UPDATE users
+SET email_verified_at = $2
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower(sqlc.arg('handle'));
+
+-- name: GetUserProfileStats :one
+SELECT
+    (SELECT count(*) FROM chirps WHERE chirps.user_id = sqlc.arg('user_id') AND chirps.deleted_at IS NULL) AS chirp_count,
+    (SELECT count(*) FROM follows WHERE follows.followee_id = sqlc.arg('user_id')) AS follower_count,
+    (SELECT count(*) FROM follows WHERE follows.follower_id = sqlc.arg('user_id')) AS following_count;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: UpdateUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: UpgradeUserPasswordHash :execrows
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $2, updated_at = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = $2
+WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: GetUsersDueForDeletion :many
+SELECT * FROM users
+WHERE delete_after <= sqlc.arg('now')
+ORDER BY delete_after
+LIMIT sqlc.arg('batch_size');
+
+-- name: LockUser :one
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: LockUserForDeletion :one
+SELECT id FROM users
+WHERE id = $1 AND delete_after <= $2
+FOR UPDATE;
+
+-- name: DeleteUser :exec
+DELETE FROM users
 WHERE id = $1;
\ No newline at end of file
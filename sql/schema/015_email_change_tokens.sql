@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE email_change_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT NULL
+);
+CREATE INDEX email_change_tokens_user_id_idx ON email_change_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_change_tokens;
\ No newline at end of file
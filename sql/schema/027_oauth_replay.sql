@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE oauth_authorization_codes
+ADD COLUMN grant_id UUID DEFAULT NULL REFERENCES oauth_grants(id) ON DELETE SET NULL;
+
+-- refresh tokens a grant rotated away from, kept so a replayed one can be recognised
+CREATE TABLE oauth_retired_refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    grant_id UUID NOT NULL REFERENCES oauth_grants(id) ON DELETE CASCADE,
+    retired_at TIMESTAMP NOT NULL
+);
+CREATE INDEX oauth_retired_refresh_tokens_grant_id_idx ON oauth_retired_refresh_tokens (grant_id);
+
+-- +goose Down
+DROP TABLE oauth_retired_refresh_tokens;
+ALTER TABLE oauth_authorization_codes
+DROP COLUMN grant_id;
\ No newline at end of file